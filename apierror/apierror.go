@@ -0,0 +1,152 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"geo_offers/i18n"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Стабильные машиночитаемые коды ошибок. Клиенты завязываются именно на них,
+// поэтому существующие значения менять нельзя, только добавлять новые.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidBody      = "invalid_body"
+	CodeUnauthorized     = "unauthorized"
+	CodeInvalidToken     = "invalid_token"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeOffersNotFound   = "offers_not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeOfferExists      = "offer_exists"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+	CodeDBUnavailable    = "db_unavailable"
+	CodeRedisUnavailable = "redis_unavailable"
+
+	CodeUnsupportedLanguage = "unsupported_language"
+	CodeUnknownGeo          = "unknown_geo"
+	CodeInsufficientScope   = "insufficient_scope"
+	CodeInvalidScope        = "invalid_scope"
+	CodeInvalidSignature    = "invalid_signature"
+)
+
+// Error - типизированная ошибка API. Её возвращают хендлеры и middleware,
+// а ErrorHandler превращает её в ответ application/problem+json.
+type Error struct {
+	Status int
+	Code   string
+	// Message - ключ сообщения в каталоге i18n, Args - аргументы для него
+	Message string
+	Args    []any
+	// Err - внутренняя причина, пишется только в лог и клиенту не отдаётся
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Title возвращает заголовок ошибки по её коду на нужном языке
+func (e *Error) Title(lang string) string {
+	key := "error." + e.Code
+	if title := i18n.T(lang, key); title != key {
+		return title
+	}
+	return http.StatusText(e.Status)
+}
+
+// Detail возвращает подробное описание ошибки на нужном языке
+func (e *Error) Detail(lang string) string {
+	if e.Message == "" {
+		return ""
+	}
+	return i18n.T(lang, e.Message, e.Args...)
+}
+
+// Wrap прикрепляет к ошибке внутреннюю причину
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// New создаёт ошибку API с указанным HTTP-статусом, кодом и ключом сообщения
+func New(status int, code, message string, args ...any) *Error {
+	return &Error{Status: status, Code: code, Message: message, Args: args}
+}
+
+func BadRequest(code, message string, args ...any) *Error {
+	return New(http.StatusBadRequest, code, message, args...)
+}
+
+func Unauthorized(code, message string, args ...any) *Error {
+	return New(http.StatusUnauthorized, code, message, args...)
+}
+
+func Forbidden(code, message string, args ...any) *Error {
+	return New(http.StatusForbidden, code, message, args...)
+}
+
+func NotFound(code, message string, args ...any) *Error {
+	return New(http.StatusNotFound, code, message, args...)
+}
+
+func Conflict(code, message string, args ...any) *Error {
+	return New(http.StatusConflict, code, message, args...)
+}
+
+func TooManyRequests(code, message string, args ...any) *Error {
+	return New(http.StatusTooManyRequests, code, message, args...)
+}
+
+// Internal оборачивает внутреннюю ошибку, детали которой клиенту не показываем
+func Internal(code string, err error) *Error {
+	return New(http.StatusInternalServerError, code, "").Wrap(err)
+}
+
+// From приводит произвольную ошибку к *Error
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		// Текст ошибок Fiber не локализован, поэтому отдаём только заголовок по коду
+		return New(fiberErr.Code, codeByStatus(fiberErr.Code), "").Wrap(err)
+	}
+
+	return Internal(CodeInternal, err)
+}
+
+// codeByStatus подбирает общий код для ошибок, пришедших не из нашего кода (например, из роутера Fiber)
+func codeByStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
@@ -0,0 +1,45 @@
+package apierror
+
+import (
+	"geo_offers/config"
+	"geo_offers/i18n"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ContentType - тип ответа для ошибок по RFC 7807
+const ContentType = "application/problem+json"
+
+// Problem - тело ответа с ошибкой (RFC 7807) плюс наши расширения code и request_id
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Handler - центральный ErrorHandler для fiber.Config.
+// Любая ошибка, которую вернул хендлер или middleware, отдаётся клиенту в одном формате.
+func Handler(c *fiber.Ctx, err error) error {
+	apiErr := From(err)
+
+	if apiErr.Status >= fiber.StatusInternalServerError {
+		config.Log("apierror").ErrorContext(c.UserContext(), "Ошибка обработки запроса",
+			"method", c.Method(), "path", c.Path(), "code", apiErr.Code, "error", apiErr)
+	}
+
+	lang := i18n.Lang(c)
+	problem := Problem{
+		Type:      "urn:geo-offers:error:" + apiErr.Code,
+		Title:     apiErr.Title(lang),
+		Status:    apiErr.Status,
+		Detail:    apiErr.Detail(lang),
+		Instance:  c.OriginalURL(),
+		Code:      apiErr.Code,
+		RequestID: config.RequestIDFrom(c.UserContext()),
+	}
+
+	return c.Status(apiErr.Status).JSON(problem, ContentType)
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"geo_offers/config"
+	"geo_offers/models"
+)
+
+// keyPrefix отличает наши ключи от прочих токенов и помогает искать утёкшие ключи
+const keyPrefix = "gok_"
+
+var (
+	ErrInvalidKey = errors.New("неверный ключ API")
+	ErrRevokedKey = errors.New("ключ API отозван")
+	ErrExpiredKey = errors.New("срок действия ключа API истёк")
+)
+
+// GenerateKey создаёт новый ключ. Открытый ключ показывается клиенту один раз, в БД идёт только хеш.
+func GenerateKey() (plain, prefix, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+
+	plain = keyPrefix + hex.EncodeToString(buf)
+	return plain, plain[:len(keyPrefix)+8], HashKey(plain), nil
+}
+
+// HashKey возвращает SHA-256 ключа в hex
+func HashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate проверяет ключ API или JWT (если приём JWT включён) и возвращает субъекта с его правами
+func Authenticate(ctx context.Context, plain string) (*Principal, error) {
+	if plain == "" {
+		return nil, ErrInvalidKey
+	}
+	if jwtConfig != nil && looksLikeJWT(plain) {
+		return AuthenticateJWT(plain)
+	}
+
+	hash := HashKey(plain)
+
+	// Статический API_TOKEN оставлен для совместимости и выпуска первых ключей, у него права admin
+	if static := os.Getenv("API_TOKEN"); static != "" && constantTimeEqual(hash, HashKey(static)) {
+		return &Principal{Type: PrincipalStaticToken, Name: "API_TOKEN", Scopes: []string{ScopeAdmin}}, nil
+	}
+
+	var key models.APIKey
+	db := config.DB.WithContext(ctx)
+	result := db.Where("key_hash = ?", hash).Limit(1).Find(&key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || !constantTimeEqual(hash, key.KeyHash) {
+		return nil, ErrInvalidKey
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, ErrRevokedKey
+	}
+	if !key.Active(now) {
+		return nil, ErrExpiredKey
+	}
+
+	db.Model(&key).UpdateColumn("last_used_at", now)
+
+	return &Principal{Type: PrincipalAPIKey, KeyID: key.ID, Name: key.Name, Scopes: key.ScopeList()}, nil
+}
+
+// BearerToken достаёт ключ из заголовка Authorization. Без схемы Bearer ключ принимается как есть (старый формат).
+func BearerToken(header string) string {
+	header = strings.TrimSpace(header)
+	if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return header
+}
+
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"geo_offers/config"
+)
+
+// jwksRetryInterval - по URL набор запрашивается не чаще раза в этот интервал: и при неизвестном kid,
+// и после неудачной загрузки, чтобы недоступный провайдер не тормозил каждый запрос с JWT
+const jwksRetryInterval = time.Minute
+
+// jwk - открытый ключ в формате JWK (RFC 7517). Поддерживаются RSA и EC.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// KeySet - набор открытых ключей для проверки подписи JWT.
+// Ключи берутся из локального файла или по URL; по URL набор периодически обновляется.
+type KeySet struct {
+	file    string
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// attemptedAt - время последней попытки загрузки, в том числе неудачной
+	attemptedAt time.Time
+	// refreshing - загрузка уже идёт, другие запросы её не повторяют
+	refreshing bool
+}
+
+// NewKeySet создаёт набор ключей и сразу загружает его из файла или по URL
+func NewKeySet(file, url string, refresh time.Duration) (*KeySet, error) {
+	ks := &KeySet{file: file, url: url, refresh: refresh, client: &http.Client{Timeout: 10 * time.Second}, attemptedAt: time.Now()}
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Key возвращает ключ по kid. Если kid не указан, а ключ в наборе один - возвращает его.
+// Устаревший набор обновляется в фоне, а запросы тем временем проверяются по прежним ключам.
+// Неизвестный kid при загрузке по URL приводит к внеочередному обновлению набора (не чаще раза в минуту).
+func (ks *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	if ks.url != "" && ks.stale(ks.refresh) && ks.startAttempt() {
+		go ks.reload()
+	}
+
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	if ks.url != "" && ks.startAttempt() {
+		ks.reload()
+		if key, ok := ks.lookup(kid); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("ключ %q не найден в JWKS", kid)
+}
+
+// startAttempt отмечает начало загрузки, если загрузка сейчас не идёт и прошлая попытка была больше jwksRetryInterval назад
+func (ks *KeySet) startAttempt() bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if ks.refreshing || time.Since(ks.attemptedAt) < jwksRetryInterval {
+		return false
+	}
+	ks.refreshing = true
+	ks.attemptedAt = time.Now()
+	return true
+}
+
+// reload загружает набор по URL после startAttempt. При ошибке остаются прежние ключи.
+func (ks *KeySet) reload() {
+	err := ks.load()
+
+	ks.mu.Lock()
+	ks.refreshing = false
+	ks.mu.Unlock()
+
+	if err != nil {
+		config.Log("auth").Error("Ошибка обновления JWKS, используются прежние ключи", "url", ks.url, "error", err)
+	}
+}
+
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (ks *KeySet) stale(age time.Duration) bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return age > 0 && time.Since(ks.fetchedAt) > age
+}
+
+func (ks *KeySet) load() error {
+	data, err := ks.read()
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	ks.mu.Unlock()
+	return nil
+}
+
+func (ks *KeySet) read() ([]byte, error) {
+	if ks.file != "" {
+		return os.ReadFile(ks.file)
+	}
+
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS %s: статус %d", ks.url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS разбирает документ {"keys": [...]}. Ключи не для подписи и неподдерживаемых типов пропускаются.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("ошибка разбора JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaKey()
+		case "EC":
+			key, err = k.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ключ %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("в JWKS нет ключей для проверки подписи")
+	}
+	return keys, nil
+}
+
+func (k jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() {
+		return nil, fmt.Errorf("некорректная экспонента RSA")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jwk) ecKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("неподдерживаемая кривая %q", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("точка не лежит на кривой %s", k.Crv)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PrincipalJWT - партнёр, пришедший с JWT от нашего OIDC-провайдера
+const PrincipalJWT = "jwt"
+
+// ErrInvalidJWT - JWT не прошёл проверку подписи, срока действия, issuer или audience
+var ErrInvalidJWT = errors.New("неверный JWT")
+
+// JWTConfig - настройки проверки JWT
+type JWTConfig struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+}
+
+// jwtConfig - текущие настройки; nil, если проверка JWT выключена
+var jwtConfig *JWTConfig
+
+// SetupJWT включает приём JWT, если задан JWT_JWKS_FILE или JWT_JWKS_URL
+func SetupJWT() error {
+	file, url := os.Getenv("JWT_JWKS_FILE"), os.Getenv("JWT_JWKS_URL")
+	if file == "" && url == "" {
+		return nil
+	}
+
+	refresh := time.Hour
+	if value := os.Getenv("JWT_JWKS_REFRESH"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("JWT_JWKS_REFRESH: %w", err)
+		}
+		refresh = parsed
+	}
+
+	keys, err := NewKeySet(file, url, refresh)
+	if err != nil {
+		return err
+	}
+
+	ConfigureJWT(&JWTConfig{Keys: keys, Issuer: os.Getenv("JWT_ISSUER"), Audience: os.Getenv("JWT_AUDIENCE")})
+	return nil
+}
+
+// ConfigureJWT задаёт настройки проверки JWT (nil выключает приём JWT)
+func ConfigureJWT(cfg *JWTConfig) {
+	jwtConfig = cfg
+}
+
+// partnerClaims - claims токена партнёрского портала
+type partnerClaims struct {
+	jwt.RegisteredClaims
+	// Scope - права через пробел (OAuth 2.0), Scp - то же самое массивом (Azure AD, Okta)
+	Scope     string   `json:"scope"`
+	Scp       []string `json:"scp"`
+	PartnerID string   `json:"partner_id"`
+}
+
+// looksLikeJWT - в JWT три части через точку, в наших ключах API точек нет
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// AuthenticateJWT проверяет JWT и переводит claims scope/scp и partner_id в права субъекта.
+// Неизвестные нам права из токена отбрасываются.
+func AuthenticateJWT(token string) (*Principal, error) {
+	cfg := jwtConfig
+	if cfg == nil {
+		return nil, ErrInvalidKey
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	var claims partnerClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return cfg.Keys.Key(kid)
+	}, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJWT, err)
+	}
+
+	var scopes []string
+	for _, scope := range append(strings.Fields(claims.Scope), claims.Scp...) {
+		if ValidScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &Principal{Type: PrincipalJWT, Name: claims.Subject, PartnerID: claims.PartnerID, Scopes: scopes}, nil
+}
@@ -0,0 +1,153 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"geo_offers/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func b64(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+// setupJWKS генерирует локальные ключи RSA и EC, пишет их в JWKS-файл и включает приём JWT.
+func setupJWKS(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)},
+		},
+	}
+	data, err := json.Marshal(jwks)
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(file, data, 0600))
+
+	keys, err := auth.NewKeySet(file, "", 0)
+	assert.NoError(t, err)
+	auth.ConfigureJWT(&auth.JWTConfig{Keys: keys, Issuer: "https://partners.example", Audience: "geo-offers"})
+	t.Cleanup(func() { auth.ConfigureJWT(nil) })
+
+	return rsaKey, ecKey
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":        "https://partners.example",
+		"aud":        "geo-offers",
+		"sub":        "partner-portal",
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"scope":      "openid offers:write",
+		"partner_id": "p-42",
+	}
+}
+
+// TestAuthenticateJWT проверяет, что claims scope и partner_id переходят в права субъекта.
+func TestAuthenticateJWT(t *testing.T) {
+	rsaKey, ecKey := setupJWKS(t)
+
+	principal, err := auth.Authenticate(context.Background(), sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, auth.PrincipalJWT, principal.Type)
+	assert.Equal(t, "p-42", principal.PartnerID)
+	assert.Equal(t, []string{auth.ScopeOffersWrite}, principal.Scopes)
+	assert.True(t, principal.HasScope(auth.ScopeOffersWrite))
+	assert.False(t, principal.HasScope(auth.ScopeAdmin))
+
+	// Права массивом в claim scp
+	claims := validClaims()
+	delete(claims, "scope")
+	claims["scp"] = []string{"offers:read", "sync:run"}
+	principal, err = auth.Authenticate(context.Background(), sign(t, jwt.SigningMethodES256, "ec-1", ecKey, claims))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{auth.ScopeOffersRead, auth.ScopeSyncRun}, principal.Scopes)
+}
+
+// TestAuthenticateJWTRejected проверяет отказ для просроченного токена, чужого ключа и неверного audience.
+func TestAuthenticateJWTRejected(t *testing.T) {
+	rsaKey, _ := setupJWKS(t)
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err := auth.Authenticate(context.Background(), sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, expired))
+	assert.ErrorIs(t, err, auth.ErrInvalidJWT)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, err = auth.Authenticate(context.Background(), sign(t, jwt.SigningMethodRS256, "rsa-1", otherKey, validClaims()))
+	assert.ErrorIs(t, err, auth.ErrInvalidJWT)
+
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "someone-else"
+	_, err = auth.Authenticate(context.Background(), sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, wrongAudience))
+	assert.ErrorIs(t, err, auth.ErrInvalidJWT)
+
+	// Симметричные алгоритмы не принимаем
+	_, err = auth.Authenticate(context.Background(), sign(t, jwt.SigningMethodHS256, "rsa-1", []byte("secret"), validClaims()))
+	assert.ErrorIs(t, err, auth.ErrInvalidJWT)
+}
+
+// TestKeySetURLOutage проверяет, что недоступный JWKS не запрашивается на каждый запрос: прежние ключи продолжают
+// работать, а неизвестный kid не приводит к повторным загрузкам чаще раза в минуту.
+func TestKeySetURLOutage(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{"kty": "RSA", "kid": "rsa-1", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))}},
+	})
+	assert.NoError(t, err)
+
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Первая загрузка удаётся, дальше провайдер недоступен
+		if fetches.Add(1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	keys, err := auth.NewKeySet("", server.URL, time.Millisecond)
+	assert.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	for i := 0; i < 20; i++ {
+		key, err := keys.Key("rsa-1")
+		assert.NoError(t, err)
+		assert.NotNil(t, key)
+		_, err = keys.Key("rotated")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Виды политик доступа к группе маршрутов
+const (
+	// PolicyPublic - доступ без проверок
+	PolicyPublic = "public"
+	// PolicyToken - любой действующий ключ API
+	PolicyToken = "token"
+	// PolicyScope - ключ API с указанными правами
+	PolicyScope = "scope"
+	// PolicyIP - запрос с адреса из списка подсетей
+	PolicyIP = "ip"
+)
+
+// Policy - одно правило доступа
+type Policy struct {
+	Kind   string
+	Scopes []string
+	Nets   []*net.IPNet
+}
+
+// Public разрешает доступ всем
+func Public() Policy {
+	return Policy{Kind: PolicyPublic}
+}
+
+// Token требует любой действующий ключ API
+func Token() Policy {
+	return Policy{Kind: PolicyToken}
+}
+
+// Scoped требует ключ API со всеми перечисленными правами
+func Scoped(scopes ...string) Policy {
+	return Policy{Kind: PolicyScope, Scopes: scopes}
+}
+
+// ParsePolicies разбирает политики из строки конфигурации. Доступ есть, если выполнено любое из правил,
+// правила разделяются "|":
+//
+//	public
+//	token
+//	scope:sync:run,admin
+//	ip:10.0.0.0/8,127.0.0.1 | scope:admin
+func ParsePolicies(value string) ([]Policy, error) {
+	var policies []Policy
+	for _, part := range strings.Split(value, "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kind, args, _ := strings.Cut(part, ":")
+		switch kind {
+		case PolicyPublic:
+			policies = append(policies, Public())
+		case PolicyToken:
+			policies = append(policies, Token())
+		case PolicyScope:
+			scopes := splitList(args)
+			if len(scopes) == 0 {
+				return nil, fmt.Errorf("политика %q: не указаны права", part)
+			}
+			for _, scope := range scopes {
+				if !ValidScope(scope) {
+					return nil, fmt.Errorf("политика %q: неизвестное право %q", part, scope)
+				}
+			}
+			policies = append(policies, Scoped(scopes...))
+		case PolicyIP:
+			nets, err := ParseNets(splitList(args))
+			if err != nil {
+				return nil, fmt.Errorf("политика %q: %w", part, err)
+			}
+			if len(nets) == 0 {
+				return nil, fmt.Errorf("политика %q: не указаны адреса", part)
+			}
+			policies = append(policies, Policy{Kind: PolicyIP, Nets: nets})
+		default:
+			return nil, fmt.Errorf("неизвестная политика доступа %q", part)
+		}
+	}
+
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("политика доступа не задана")
+	}
+	return policies, nil
+}
+
+// ParseNets разбирает список подсетей CIDR и отдельных адресов
+func ParseNets(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("некорректный адрес %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("некорректная подсеть %q", value)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// AllowsIP проверяет, входит ли адрес в подсети политики
+func (p Policy) AllowsIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range p.Nets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
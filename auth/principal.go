@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Права доступа, которые выдаются ключам API
+const (
+	ScopeOffersRead  = "offers:read"
+	ScopeOffersWrite = "offers:write"
+	ScopeSyncRun     = "sync:run"
+	// ScopeAdmin включает в себя все остальные права
+	ScopeAdmin = "admin"
+)
+
+// Scopes - все известные права
+var Scopes = []string{ScopeOffersRead, ScopeOffersWrite, ScopeSyncRun, ScopeAdmin}
+
+// Типы субъектов, от имени которых выполняется запрос
+const (
+	PrincipalAPIKey = "api_key"
+	// PrincipalStaticToken - ключ из переменной API_TOKEN, нужен для выпуска первых ключей
+	PrincipalStaticToken = "static_token"
+)
+
+// LocalsKey - ключ в c.Locals, под которым middleware сохраняет субъекта запроса
+const LocalsKey = "principal"
+
+// Principal - аутентифицированный субъект запроса
+type Principal struct {
+	Type   string
+	KeyID  uint
+	Name   string
+	Scopes []string
+	// PartnerID - идентификатор партнёра из JWT
+	PartnerID string
+}
+
+// HasScope проверяет наличие права (admin даёт все права)
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// FromCtx возвращает субъекта текущего запроса или nil, если запрос анонимный
+func FromCtx(c *fiber.Ctx) *Principal {
+	principal, _ := c.Locals(LocalsKey).(*Principal)
+	return principal
+}
+
+// ValidScope проверяет, что право известно
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"geo_offers/config"
+	"geo_offers/models"
+)
+
+// PrincipalSignedKey - ключ API, запрос от которого подписан HMAC
+const PrincipalSignedKey = "signed_key"
+
+// Заголовки подписанного запроса
+const (
+	HeaderSignatureKey       = "X-Signature-Key"
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+	HeaderSignatureNonce     = "X-Signature-Nonce"
+	HeaderSignature          = "X-Signature"
+)
+
+var (
+	ErrInvalidSignature  = errors.New("неверная подпись запроса")
+	ErrStaleSignature    = errors.New("метка времени подписи вне допустимого окна")
+	ErrReplayedSignature = errors.New("nonce подписи уже использован")
+)
+
+// SignedRequest - данные запроса, по которым проверяется подпись
+type SignedRequest struct {
+	KeyID     string
+	Timestamp string
+	Nonce     string
+	Signature string
+	Method    string
+	// Path - путь вместе со строкой запроса
+	Path string
+	Body []byte
+}
+
+// GenerateSigningSecret создаёт секрет для подписи запросов
+func GenerateSigningSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Sign считает HMAC-SHA256 подпись запроса. Подписывается строка:
+//
+//	METHOD \n PATH \n TIMESTAMP \n NONCE \n hex(sha256(BODY))
+func Sign(secret, method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{strings.ToUpper(method), path, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureWindow - допустимое расхождение метки времени с часами сервера (SIGNATURE_WINDOW, по умолчанию 5m)
+func signatureWindow() time.Duration {
+	if window, err := time.ParseDuration(os.Getenv("SIGNATURE_WINDOW")); err == nil && window > 0 {
+		return window
+	}
+	return 5 * time.Minute
+}
+
+// AuthenticateSignature проверяет HMAC-подпись запроса секретом ключа API и защищает от повторов:
+// метка времени должна попадать в окно, а nonce - встречаться впервые (nonce хранятся в Redis).
+func AuthenticateSignature(ctx context.Context, req SignedRequest) (*Principal, error) {
+	keyID, err := strconv.ParseUint(req.KeyID, 10, 64)
+	if err != nil || req.Nonce == "" || len(req.Nonce) > 128 {
+		return nil, ErrInvalidSignature
+	}
+
+	timestamp, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	window := signatureWindow()
+	if skew := time.Since(time.Unix(timestamp, 0)); skew > window || skew < -window {
+		return nil, ErrStaleSignature
+	}
+
+	var key models.APIKey
+	db := config.DB.WithContext(ctx)
+	result := db.Where("id = ?", keyID).Limit(1).Find(&key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || key.SigningSecret == "" {
+		return nil, ErrInvalidSignature
+	}
+
+	expected := Sign(key.SigningSecret, req.Method, req.Path, req.Timestamp, req.Nonce, req.Body)
+	signature := strings.TrimPrefix(strings.ToLower(req.Signature), "sha256=")
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, ErrInvalidSignature
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, ErrRevokedKey
+	}
+	if !key.Active(now) {
+		return nil, ErrExpiredKey
+	}
+
+	// Nonce проверяем после подписи, чтобы чужие запросы не могли занять nonce партнёра.
+	// Храним его чуть дольше окна, чтобы запрос не прошёл повторно на границе.
+	nonceKey := fmt.Sprintf("signature:nonce:%d:%s", key.ID, req.Nonce)
+	fresh, err := config.RedisClient.SetNX(ctx, nonceKey, 1, 2*window).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrReplayedSignature
+	}
+
+	db.Model(&key).UpdateColumn("last_used_at", now)
+
+	return &Principal{Type: PrincipalSignedKey, KeyID: key.ID, Name: key.Name, Scopes: key.ScopeList()}, nil
+}
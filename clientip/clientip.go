@@ -0,0 +1,156 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Заголовки, из которых берётся адрес клиента за прокси
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = fiber.HeaderXForwardedFor
+	HeaderXRealIP       = "X-Real-Ip"
+)
+
+// LocalsKey - ключ в c.Locals, под которым middleware сохраняет адрес клиента
+const LocalsKey = "client_ip"
+
+// DefaultHeaders - порядок, в котором проверяются заголовки прокси
+var DefaultHeaders = []string{HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP}
+
+// Resolver определяет адрес клиента. Заголовкам прокси верим, только если запрос пришёл с доверенного адреса,
+// а в цепочке адресов берём ближайший к нам адрес, который не принадлежит доверенному прокси.
+type Resolver struct {
+	Trusted []*net.IPNet
+	Headers []string
+}
+
+// New создаёт Resolver. Без доверенных прокси заголовки не читаются вовсе.
+func New(trusted []*net.IPNet, headers []string) (*Resolver, error) {
+	if len(headers) == 0 {
+		headers = DefaultHeaders
+	}
+	for i, header := range headers {
+		switch {
+		case strings.EqualFold(header, HeaderForwarded):
+			headers[i] = HeaderForwarded
+		case strings.EqualFold(header, HeaderXForwardedFor):
+			headers[i] = HeaderXForwardedFor
+		case strings.EqualFold(header, HeaderXRealIP):
+			headers[i] = HeaderXRealIP
+		default:
+			return nil, fmt.Errorf("неподдерживаемый заголовок %q", header)
+		}
+	}
+	return &Resolver{Trusted: trusted, Headers: headers}, nil
+}
+
+// Resolve возвращает адрес клиента по адресу соединения и заголовкам запроса
+func (r *Resolver) Resolve(remote string, header func(string) string) string {
+	if !r.trusted(remote) {
+		return remote
+	}
+
+	for _, name := range r.Headers {
+		value := header(name)
+		if value == "" {
+			continue
+		}
+
+		var chain []string
+		switch name {
+		case HeaderForwarded:
+			chain = parseForwarded(value)
+		case HeaderXForwardedFor:
+			chain = strings.Split(value, ",")
+		case HeaderXRealIP:
+			chain = []string{value}
+		}
+		if ip, ok := r.fromChain(chain); ok {
+			return ip
+		}
+	}
+	return remote
+}
+
+// fromChain идёт по цепочке справа налево (от ближайшего прокси) и пропускает доверенные адреса
+func (r *Resolver) fromChain(chain []string) (string, bool) {
+	client := ""
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip, ok := parseAddr(chain[i])
+		if !ok {
+			// Дальше некорректного адреса цепочке верить нельзя
+			break
+		}
+		client = ip
+		if !r.trusted(ip) {
+			break
+		}
+	}
+	return client, client != ""
+}
+
+func (r *Resolver) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range r.Trusted {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseForwarded достаёт адреса for= из заголовка Forwarded (RFC 7239)
+func parseForwarded(value string) []string {
+	var chain []string
+	for _, element := range strings.Split(value, ",") {
+		forwardedFor := ""
+		for _, pair := range strings.Split(element, ";") {
+			key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				forwardedFor = strings.Trim(val, `"`)
+			}
+		}
+		// Элемент без for= (или с for=unknown) ломает цепочку так же, как некорректный адрес
+		chain = append(chain, forwardedFor)
+	}
+	return chain
+}
+
+// parseAddr разбирает адрес с необязательным портом: 1.2.3.4, 1.2.3.4:80, [2001:db8::1]:80, 2001:db8::1
+func parseAddr(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap().String(), true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		return "", false
+	}
+	return addr.Unmap().String(), true
+}
+
+// Middleware определяет адрес клиента один раз и сохраняет его для остальных middleware и хендлеров
+func Middleware(resolver *Resolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		remote := c.Context().RemoteIP().String()
+		header := func(name string) string { return c.Get(name) }
+		c.Locals(LocalsKey, resolver.Resolve(remote, header))
+		return c.Next()
+	}
+}
+
+// FromCtx возвращает адрес клиента. Если middleware не подключено - адрес соединения.
+func FromCtx(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(LocalsKey).(string); ok {
+		return ip
+	}
+	return c.IP()
+}
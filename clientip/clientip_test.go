@@ -0,0 +1,70 @@
+package clientip_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"geo_offers/auth"
+	"geo_offers/clientip"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestResolve проверяет разбор заголовков прокси и недоверие к заголовкам от чужих адресов.
+func TestResolve(t *testing.T) {
+	trusted, err := auth.ParseNets([]string{"10.0.0.0/8", "::1"})
+	assert.NoError(t, err)
+	resolver, err := clientip.New(trusted, nil)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"без прокси", "203.0.113.5", nil, "203.0.113.5"},
+		{"заголовок от недоверенного адреса", "203.0.113.5", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.5"},
+		{"X-Forwarded-For", "10.0.0.1", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"поддельный адрес слева в цепочке", "10.0.0.1", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"X-Real-IP", "10.0.0.1", map[string]string{"X-Real-Ip": "198.51.100.8"}, "198.51.100.8"},
+		{"Forwarded с IPv6 и портом", "::1", map[string]string{"Forwarded": `for="[2001:db8::17]:4711";proto=https, for=10.0.0.3`}, "2001:db8::17"},
+		{"Forwarded важнее X-Forwarded-For", "10.0.0.1", map[string]string{"Forwarded": "for=198.51.100.9", "X-Forwarded-For": "198.51.100.7"}, "198.51.100.9"},
+		{"некорректный заголовок", "10.0.0.1", map[string]string{"X-Forwarded-For": "garbage"}, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolver.Resolve(tt.remote, func(name string) string { return tt.headers[name] })
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = clientip.New(nil, []string{"X-Client-IP"})
+	assert.Error(t, err)
+}
+
+// TestMiddleware проверяет, что адрес клиента доступен через FromCtx.
+func TestMiddleware(t *testing.T) {
+	// app.Test отправляет запросы с адреса 0.0.0.0
+	trusted, err := auth.ParseNets([]string{"0.0.0.0"})
+	assert.NoError(t, err)
+	resolver, err := clientip.New(trusted, []string{"x-forwarded-for"})
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(clientip.Middleware(resolver))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(clientip.FromCtx(c))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "198.51.100.7", string(body))
+}
@@ -2,8 +2,11 @@ package config_test
 
 import (
 	"context"
+	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"geo_offers/config"
@@ -33,6 +36,36 @@ func TestSetupLogger(t *testing.T) {
 	assert.False(t, info.IsDir())
 }
 
+// TestLogLevels проверяет JSON-формат, уровни пакетов и поля из контекста.
+func TestLogLevels(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+	t.Setenv("LOG_OUTPUT", config.LogOutputFile)
+	t.Setenv("LOG_FILE", file)
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("LOG_LEVELS", "services=debug")
+	config.SetupLogger()
+
+	ctx := config.WithLogAttrs(context.Background(), slog.String("run_id", "run-1"))
+	config.Log("services").DebugContext(ctx, "sync debug")
+	config.Log("handlers").Info("handlers info")
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+
+	// Запись о запуске логирования на уровне info отсекается общим уровнем warn, как и info пакета handlers
+	assert.Len(t, records, 1)
+	assert.Equal(t, "sync debug", records[0]["msg"])
+	assert.Equal(t, "services", records[0]["package"])
+	assert.Equal(t, "run-1", records[0]["run_id"])
+}
+
 // TestConnectRedis проверяет, что ConnectRedis устанавливает соединение с Redis.
 // Для эмуляции Redis используется miniredis.
 func TestConnectRedis(t *testing.T) {
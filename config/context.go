@@ -0,0 +1,21 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID сохраняет идентификатор запроса в контексте. Он же добавляется в поля лога,
+// так что попадает в записи HTTP-слоя, запросов к БД и Redis, сделанных с этим контекстом.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	return WithLogAttrs(ctx, slog.String("request_id", requestID))
+}
+
+// RequestIDFrom возвращает идентификатор запроса из контекста или пустую строку
+func RequestIDFrom(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
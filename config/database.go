@@ -2,7 +2,6 @@ package config
 
 import (
 	"fmt"
-	"log"
 	"os"
 
 	"geo_offers/models"
@@ -16,7 +15,7 @@ var DB *gorm.DB
 func ConnectDB() {
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal("Ошибка загрузки .env")
+		Fatal(Log("config"), "Ошибка загрузки .env", "error", err)
 	}
 
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
@@ -27,18 +26,34 @@ func ConnectDB() {
 		os.Getenv("DB_NAME"),
 	)
 
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: gormLogger{}})
 	if err != nil {
-		log.Fatal("Ошибка подключения к БД:", err)
+		Fatal(Log("config"), "Ошибка подключения к БД", "error", err)
+	}
+
+	// Дневные агрегаты раньше группировались по пути запроса (endpoint), теперь - по шаблону маршрута
+	if db.Migrator().HasColumn(&models.RequestLogDaily{}, "endpoint") {
+		if err := db.Migrator().RenameColumn(&models.RequestLogDaily{}, "endpoint", "route"); err != nil {
+			Fatal(Log("config"), "Ошибка миграции БД", "column", "endpoint", "error", err)
+		}
 	}
 
 	// Здесь мы миграцию запускаем через Горм
 	err = db.AutoMigrate(&models.Offer{})
-	err = db.AutoMigrate(&models.RequestLog{})
+	err = db.AutoMigrate(&models.RequestLog{}, &models.RequestLogDaily{}, &models.GeoName{}, &models.OfferName{}, &models.APIKey{}, &models.AuditEvent{})
 	if err != nil {
-		log.Fatal("Ошибка миграции БД:", err)
+		Fatal(Log("config"), "Ошибка миграции БД", "error", err)
+	}
+
+	// Журнал запросов раньше был на gorm.Model: колонки мягкого удаления не использовались и больше не нужны
+	for _, column := range []string{"updated_at", "deleted_at"} {
+		if db.Migrator().HasColumn(&models.RequestLog{}, column) {
+			if err := db.Migrator().DropColumn(&models.RequestLog{}, column); err != nil {
+				Fatal(Log("config"), "Ошибка миграции БД", "column", column, "error", err)
+			}
+		}
 	}
 
 	DB = db
-	fmt.Println("Подключение к БД установлено и миграция выполнена")
+	Log("config").Info("Подключение к БД установлено и миграция выполнена")
 }
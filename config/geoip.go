@@ -0,0 +1,29 @@
+package config
+
+import (
+	"os"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP - локальная база MaxMind (.mmdb) для определения страны по IP.
+// Если база не настроена, остаётся nil и используется GEO по умолчанию.
+var GeoIP *maxminddb.Reader
+
+// ConnectGeoIP открывает базу GeoIP по пути из GEOIP_DB_PATH
+func ConnectGeoIP() {
+	path := os.Getenv("GEOIP_DB_PATH")
+	if path == "" {
+		Log("config").Warn("GEOIP_DB_PATH не задан, GEO по IP определяться не будет")
+		return
+	}
+
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		Log("config").Error("Ошибка открытия базы GeoIP", "path", path, "error", err)
+		return
+	}
+
+	GeoIP = reader
+	Log("config").Info("База GeoIP загружена", "path", path, "type", reader.Metadata.DatabaseType)
+}
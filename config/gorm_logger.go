@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold - запросы дольше этого пишутся в лог как медленные
+const slowQueryThreshold = 200 * time.Millisecond
+
+// gormLogger пишет запросы GORM в лог пакета db с полями из контекста (request_id, run_id):
+// ошибки - на уровне error, медленные запросы - warn, остальные - debug.
+// Чтобы поля попали в запись, запрос делается через DB.WithContext(ctx).
+type gormLogger struct{}
+
+func (gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	// Уровень задаётся через LOG_LEVELS (db=debug), а не через GORM
+	return gormLogger{}
+}
+
+func (gormLogger) Info(ctx context.Context, msg string, args ...any) {
+	Log("db").InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (gormLogger) Warn(ctx context.Context, msg string, args ...any) {
+	Log("db").WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (gormLogger) Error(ctx context.Context, msg string, args ...any) {
+	Log("db").ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	logger := Log("db")
+	elapsed := time.Since(begin)
+
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		logger.ErrorContext(ctx, "Ошибка запроса к БД", "sql", sql, "rows", rows, "duration", elapsed, "error", err)
+	case elapsed > slowQueryThreshold:
+		sql, rows := fc()
+		logger.WarnContext(ctx, "Медленный запрос к БД", "sql", sql, "rows", rows, "duration", elapsed)
+	case logger.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		logger.DebugContext(ctx, "Запрос к БД", "sql", sql, "rows", rows, "duration", elapsed)
+	}
+}
@@ -1,22 +1,274 @@
 package config
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"geo_offers/logrotate"
+)
+
+// Куда писать логи (LOG_OUTPUT)
+const (
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file"
+	LogOutputBoth   = "both"
 )
 
-var Logger *log.Logger
+// Logger - корневой логгер приложения. Пакеты пишут через Log(<имя пакета>),
+// чтобы у записи было поле package и действовал уровень этого пакета.
+var Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+var (
+	logMu         sync.RWMutex
+	logHandler    slog.Handler = Logger.Handler()
+	logLevel                   = slog.LevelInfo
+	packageLevels              = map[string]slog.Level{}
+	// loggers - логгеры пакетов, пересоздаются при SetupLogger
+	loggers sync.Map
+	// logFile - файл лога, переоткрывается по SIGHUP
+	logFile        *logrotate.File
+	reopenOnSIGHUP sync.Once
+)
 
+// SetupLogger настраивает логирование из переменных окружения:
+// LOG_FORMAT (json или text), LOG_OUTPUT (stdout, file или both), LOG_FILE (по умолчанию logs/app.log),
+// LOG_LEVEL (общий уровень) и LOG_LEVELS (уровни пакетов, например "services=debug,middleware=warn").
 func SetupLogger() {
-	if err := os.MkdirAll("logs", 0755); err != nil {
-		log.Fatalf("Ошибка создания директории для логов: %v", err)
+	var warnings []string
+
+	output := strings.ToLower(os.Getenv("LOG_OUTPUT"))
+	if output == "" {
+		output = LogOutputBoth
+	}
+	var writers []io.Writer
+	if output == LogOutputStdout || output == LogOutputBoth {
+		writers = append(writers, os.Stdout)
+	}
+	if output == LogOutputFile || output == LogOutputBoth {
+		file, err := openLogFile(envOr("LOG_FILE", filepath.Join("logs", "app.log")), &warnings)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		writers = append(writers, file)
 	}
+	if len(writers) == 0 {
+		warnings = append(warnings, fmt.Sprintf("неизвестный LOG_OUTPUT %q, логи пишутся в stdout", output))
+		writers = append(writers, os.Stdout)
+	}
+
+	// Уровень фильтрует levelHandler, сам обработчик пропускает всё
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var handler slog.Handler
+	switch format := strings.ToLower(envOr("LOG_FORMAT", "json")); format {
+	case "text":
+		handler = slog.NewTextHandler(io.MultiWriter(writers...), options)
+	default:
+		if format != "json" {
+			warnings = append(warnings, fmt.Sprintf("неизвестный LOG_FORMAT %q, используется json", format))
+		}
+		handler = slog.NewJSONHandler(io.MultiWriter(writers...), options)
+	}
+
+	level := slog.LevelInfo
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			warnings = append(warnings, fmt.Sprintf("неизвестный LOG_LEVEL %q", value))
+		}
+	}
+	levels := map[string]slog.Level{}
+	for _, item := range strings.Split(os.Getenv("LOG_LEVELS"), ",") {
+		pkg, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			if item != "" {
+				warnings = append(warnings, fmt.Sprintf("LOG_LEVELS: ожидается пакет=уровень, получено %q", item))
+			}
+			continue
+		}
+		var pkgLevel slog.Level
+		if err := pkgLevel.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+			warnings = append(warnings, fmt.Sprintf("LOG_LEVELS: неизвестный уровень %q", value))
+			continue
+		}
+		levels[strings.TrimSpace(pkg)] = pkgLevel
+	}
+
+	logMu.Lock()
+	logHandler = &contextHandler{handler}
+	logLevel = level
+	packageLevels = levels
+	Logger = slog.New(&levelHandler{Handler: logHandler, level: level})
+	loggers.Clear()
+	logMu.Unlock()
+
+	Logger.Info("Логирование запущено", "format", envOr("LOG_FORMAT", "json"), "output", output, "level", level.String())
+	for _, warning := range warnings {
+		Logger.Warn(warning)
+	}
+}
+
+// Log возвращает логгер пакета. Логгер не стоит сохранять в переменную пакета:
+// SetupLogger пересоздаёт логгеры, и сохранённый продолжит писать по старым настройкам.
+func Log(pkg string) *slog.Logger {
+	if logger, ok := loggers.Load(pkg); ok {
+		return logger.(*slog.Logger)
+	}
+
+	logMu.RLock()
+	level, ok := packageLevels[pkg]
+	if !ok {
+		level = logLevel
+	}
+	handler := logHandler.WithAttrs([]slog.Attr{slog.String("package", pkg)})
+	logMu.RUnlock()
+
+	logger := slog.New(&levelHandler{Handler: handler, level: level})
+	loggers.Store(pkg, logger)
+	return logger
+}
+
+// Fatal пишет ошибку и завершает процесс
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+type logAttrsKey struct{}
+
+// WithLogAttrs добавляет в контекст поля, которые попадут во все записи лога с этим контекстом
+// (request_id, geo, run_id и т.п.). Писать нужно через методы *Context: InfoContext, ErrorContext...
+func WithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	merged = append(merged, existing...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, logAttrsKey{}, merged)
+}
 
-	file, err := os.OpenFile("logs/app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+// contextHandler дописывает в запись поля из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+// levelHandler отсекает записи ниже уровня пакета
+type levelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// openLogFile открывает файл лога с ротацией: LOG_MAX_SIZE (МБ, по умолчанию 100), LOG_ROTATE_INTERVAL (например 24h),
+// LOG_COMPRESS (gzip архивов, по умолчанию true), LOG_MAX_BACKUPS (по умолчанию 10) и LOG_MAX_AGE (например 720h).
+// Файл, открытый прошлым вызовом SetupLogger, закрывается.
+func openLogFile(path string, warnings *[]string) (*logrotate.File, error) {
+	options := logrotate.Options{MaxSize: 100 << 20, Compress: true, MaxBackups: 10}
+	if value := os.Getenv("LOG_MAX_SIZE"); value != "" {
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil && size >= 0 {
+			options.MaxSize = size << 20
+		} else {
+			*warnings = append(*warnings, fmt.Sprintf("некорректный LOG_MAX_SIZE %q", value))
+		}
+	}
+	if value := os.Getenv("LOG_ROTATE_INTERVAL"); value != "" {
+		if interval, err := time.ParseDuration(value); err == nil && interval >= 0 {
+			options.Interval = interval
+		} else {
+			*warnings = append(*warnings, fmt.Sprintf("некорректный LOG_ROTATE_INTERVAL %q", value))
+		}
+	}
+	if value := os.Getenv("LOG_COMPRESS"); value != "" {
+		if compress, err := strconv.ParseBool(value); err == nil {
+			options.Compress = compress
+		} else {
+			*warnings = append(*warnings, fmt.Sprintf("некорректный LOG_COMPRESS %q", value))
+		}
+	}
+	if value := os.Getenv("LOG_MAX_BACKUPS"); value != "" {
+		if backups, err := strconv.Atoi(value); err == nil && backups >= 0 {
+			options.MaxBackups = backups
+		} else {
+			*warnings = append(*warnings, fmt.Sprintf("некорректный LOG_MAX_BACKUPS %q", value))
+		}
+	}
+	if value := os.Getenv("LOG_MAX_AGE"); value != "" {
+		if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+			options.MaxAge = age
+		} else {
+			*warnings = append(*warnings, fmt.Sprintf("некорректный LOG_MAX_AGE %q", value))
+		}
+	}
+
+	file, err := logrotate.Open(path, options)
 	if err != nil {
-		log.Fatalf("Ошибка создания файла логов: %v", err)
+		return nil, err
+	}
+
+	logMu.Lock()
+	previous := logFile
+	logFile = file
+	logMu.Unlock()
+	if previous != nil {
+		previous.Close()
 	}
 
-	Logger = log.New(file, "", log.Ldate|log.Ltime|log.Lshortfile)
-	Logger.Println("Логирование запущено")
+	reopenOnSIGHUP.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGHUP)
+		go func() {
+			for range signals {
+				logMu.RLock()
+				file := logFile
+				logMu.RUnlock()
+				if err := file.Reopen(); err != nil {
+					Log("config").Error("Ошибка переоткрытия файла логов", "error", err)
+				} else {
+					Log("config").Info("Файл логов переоткрыт по SIGHUP")
+				}
+			}
+		}()
+	})
+	return file, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
 }
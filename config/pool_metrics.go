@@ -0,0 +1,50 @@
+package config
+
+import (
+	"geo_offers/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// RegisterPoolMetrics добавляет в метрики состояние пулов соединений: БД (go_sql_*: открытые, занятые,
+// простаивающие соединения и ожидание свободного) и Redis (redis_pool_*). Вызывается после ConnectDB и ConnectRedis.
+func RegisterPoolMetrics() {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		Log("config").Error("Метрики пула БД недоступны", "error", err)
+	} else {
+		metrics.Registry.MustRegister(collectors.NewDBStatsCollector(sqlDB, "geo_offers"))
+	}
+	metrics.Registry.MustRegister(redisPoolCollector{})
+}
+
+var (
+	redisPoolHits     = prometheus.NewDesc("redis_pool_hits_total", "Сколько раз в пуле Redis нашлось свободное соединение", nil, nil)
+	redisPoolMisses   = prometheus.NewDesc("redis_pool_misses_total", "Сколько раз в пуле Redis не нашлось свободного соединения", nil, nil)
+	redisPoolTimeouts = prometheus.NewDesc("redis_pool_timeouts_total", "Сколько раз истекло ожидание соединения из пула Redis", nil, nil)
+	redisPoolTotal    = prometheus.NewDesc("redis_pool_connections", "Соединения в пуле Redis", nil, nil)
+	redisPoolIdle     = prometheus.NewDesc("redis_pool_idle_connections", "Простаивающие соединения в пуле Redis", nil, nil)
+	redisPoolStale    = prometheus.NewDesc("redis_pool_stale_connections_total", "Устаревшие соединения, закрытые пулом Redis", nil, nil)
+)
+
+// redisPoolCollector читает статистику пула RedisClient при каждом сборе метрик
+type redisPoolCollector struct{}
+
+func (redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{redisPoolHits, redisPoolMisses, redisPoolTimeouts, redisPoolTotal, redisPoolIdle, redisPoolStale} {
+		ch <- desc
+	}
+}
+
+func (redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	if RedisClient == nil {
+		return
+	}
+	stats := RedisClient.PoolStats()
+	ch <- prometheus.MustNewConstMetric(redisPoolHits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(redisPoolMisses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(redisPoolTimeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(redisPoolTotal, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(redisPoolIdle, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(redisPoolStale, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -2,9 +2,11 @@ package config
 
 import (
 	"context"
-	"fmt"
-	"github.com/redis/go-redis/v9"
+	"errors"
+	"net"
 	"os"
+
+	"github.com/redis/go-redis/v9"
 )
 
 var RedisClient *redis.Client
@@ -17,11 +19,46 @@ func ConnectRedis() {
 		Password: "",
 		DB:       0,
 	})
+	RedisClient.AddHook(redisLogHook{})
 
 	_, err := RedisClient.Ping(ctx).Result()
 	if err != nil {
-		fmt.Println("Ошибка подключения к Redis:", err)
+		Log("config").Error("Ошибка подключения к Redis", "addr", RedisClient.Options().Addr, "error", err)
 	} else {
-		fmt.Println("Подключение к Redis успешно!")
+		Log("config").Info("Подключение к Redis успешно!", "addr", RedisClient.Options().Addr)
+	}
+}
+
+// redisLogHook пишет ошибки команд Redis в лог пакета redis с полями из контекста команды (request_id, run_id).
+// redis.Nil (ключа нет) ошибкой не считается.
+type redisLogHook struct{}
+
+func (redisLogHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			Log("redis").ErrorContext(ctx, "Ошибка подключения к Redis", "addr", addr, "error", err)
+		}
+		return conn, err
+	}
+}
+
+func (redisLogHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			Log("redis").ErrorContext(ctx, "Ошибка команды Redis", "command", cmd.Name(), "error", err)
+		}
+		return err
+	}
+}
+
+func (redisLogHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			Log("redis").ErrorContext(ctx, "Ошибка конвейера Redis", "commands", len(cmds), "error", err)
+		}
+		return err
 	}
 }
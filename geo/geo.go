@@ -0,0 +1,172 @@
+package geo
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"strings"
+)
+
+// Worldwide - код офферов, которые действуют во всех странах.
+// CityAds присылает их с кодом "Wrld", у нас он приводится к WW через алиасы.
+const Worldwide = "WW"
+
+// worldwideNames - название для Worldwide на разных языках
+var worldwideNames = map[string]string{
+	"en": "Worldwide",
+	"ru": "Весь мир",
+}
+
+// ErrUnknown - код не найден ни среди стран, ни среди алиасов и регионов
+var ErrUnknown = errors.New("неизвестный код GEO")
+
+// Country - запись справочника стран ISO 3166-1
+type Country struct {
+	Alpha2 string
+	Alpha3 string
+	// Names - названия страны по языкам (ключ - код языка)
+	Names map[string]string
+}
+
+// Region - группа стран (EU, CIS, LATAM), которую можно запросить одним кодом
+type Region struct {
+	Code    string
+	Names   map[string]string
+	Members []string
+}
+
+// Target - результат разбора кода GEO из запроса
+type Target struct {
+	// Code - канонический код: alpha-2 страны, код региона или WW
+	Code string
+	// Countries - коды офферов, которые нужно отдать по этому GEO
+	Countries []string
+	Region    bool
+}
+
+var (
+	//go:embed data/countries.csv
+	countriesCSV string
+	//go:embed data/aliases.csv
+	aliasesCSV string
+	//go:embed data/regions.csv
+	regionsCSV string
+)
+
+var (
+	countries []Country
+	regions   []Region
+	byAlpha2  = map[string]*Country{}
+	byAlpha3  = map[string]*Country{}
+	byRegion  = map[string]*Region{}
+	aliases   = map[string]string{}
+	// regionsOf - в какие регионы входит страна
+	regionsOf = map[string][]string{}
+)
+
+func init() {
+	// Колонки name_<lang> задают названия на соответствующих языках
+	header, rows := readCSV(countriesCSV)
+	countries = make([]Country, 0, len(rows))
+	for _, row := range rows {
+		countries = append(countries, Country{Alpha2: row[0], Alpha3: row[1], Names: names(header, row, 2, len(header))})
+	}
+	for i := range countries {
+		byAlpha2[countries[i].Alpha2] = &countries[i]
+		byAlpha3[countries[i].Alpha3] = &countries[i]
+	}
+
+	_, rows = readCSV(aliasesCSV)
+	for _, row := range rows {
+		aliases[row[0]] = row[1]
+	}
+
+	header, rows = readCSV(regionsCSV)
+	regions = make([]Region, 0, len(rows))
+	for _, row := range rows {
+		last := len(header) - 1
+		regions = append(regions, Region{Code: row[0], Names: names(header, row, 1, last), Members: strings.Fields(row[last])})
+	}
+	for i := range regions {
+		byRegion[regions[i].Code] = &regions[i]
+		for _, member := range regions[i].Members {
+			if _, ok := byAlpha2[member]; !ok {
+				panic("регион " + regions[i].Code + ": неизвестная страна " + member)
+			}
+			regionsOf[member] = append(regionsOf[member], regions[i].Code)
+		}
+	}
+}
+
+func readCSV(data string) ([]string, [][]string) {
+	rows, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		panic(err)
+	}
+	return rows[0], rows[1:]
+}
+
+// names собирает названия из колонок name_<lang> в диапазоне [from, to)
+func names(header, row []string, from, to int) map[string]string {
+	result := make(map[string]string, to-from)
+	for i := from; i < to; i++ {
+		result[strings.TrimPrefix(header[i], "name_")] = row[i]
+	}
+	return result
+}
+
+// Countries возвращает весь справочник стран
+func Countries() []Country {
+	return countries
+}
+
+// Regions возвращает список регионов
+func Regions() []Region {
+	return regions
+}
+
+// Lookup ищет страну по коду alpha-2 или alpha-3
+func Lookup(code string) (Country, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if country, ok := byAlpha2[code]; ok {
+		return *country, true
+	}
+	if country, ok := byAlpha3[code]; ok {
+		return *country, true
+	}
+	return Country{}, false
+}
+
+// Normalize приводит код страны (alpha-2, alpha-3 или алиас) к alpha-2.
+// Для офферов на весь мир возвращается Worldwide. Регионы сюда не входят.
+func Normalize(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if alias, ok := aliases[code]; ok {
+		code = alias
+	}
+	if code == Worldwide {
+		return Worldwide, true
+	}
+	if country, ok := Lookup(code); ok {
+		return country.Alpha2, true
+	}
+	return "", false
+}
+
+// Resolve разбирает код GEO из запроса: страну, алиас, регион или WW
+func Resolve(code string) (Target, error) {
+	if alpha2, ok := Normalize(code); ok {
+		return Target{Code: alpha2, Countries: []string{alpha2}}, nil
+	}
+
+	if region, ok := byRegion[strings.ToUpper(strings.TrimSpace(code))]; ok {
+		return Target{Code: region.Code, Countries: region.Members, Region: true}, nil
+	}
+
+	return Target{}, ErrUnknown
+}
+
+// RegionsOf возвращает коды регионов, в которые входит страна
+func RegionsOf(alpha2 string) []string {
+	return regionsOf[alpha2]
+}
@@ -0,0 +1,43 @@
+package geo_test
+
+import (
+	"testing"
+
+	"geo_offers/geo"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestResolve проверяет разбор кодов GEO: alpha-2, alpha-3, алиасы, регионы и WW.
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input     string
+		code      string
+		countries []string
+		region    bool
+	}{
+		{input: "RU", code: "RU", countries: []string{"RU"}},
+		{input: "ru", code: "RU", countries: []string{"RU"}},
+		{input: "KAZ", code: "KZ", countries: []string{"KZ"}},
+		{input: "UK", code: "GB", countries: []string{"GB"}},
+		{input: "Wrld", code: geo.Worldwide, countries: []string{geo.Worldwide}},
+		{input: "cis", code: "CIS", countries: []string{"AM", "AZ", "BY", "KG", "KZ", "MD", "RU", "TJ", "TM", "UZ"}, region: true},
+	}
+
+	for _, tt := range tests {
+		target, err := geo.Resolve(tt.input)
+		assert.NoError(t, err, tt.input)
+		assert.Equal(t, tt.code, target.Code, tt.input)
+		assert.Equal(t, tt.countries, target.Countries, tt.input)
+		assert.Equal(t, tt.region, target.Region, tt.input)
+	}
+
+	_, err := geo.Resolve("XX")
+	assert.ErrorIs(t, err, geo.ErrUnknown)
+}
+
+// TestRegionsOf проверяет обратную связь страна -> регионы.
+func TestRegionsOf(t *testing.T) {
+	assert.Equal(t, []string{"EU"}, geo.RegionsOf("DE"))
+	assert.Equal(t, []string{"CIS"}, geo.RegionsOf("RU"))
+	assert.Empty(t, geo.RegionsOf("US"))
+}
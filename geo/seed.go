@@ -0,0 +1,23 @@
+package geo
+
+import (
+	"geo_offers/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SeedNames заполняет таблицу geo_names названиями стран из встроенного справочника.
+// Уже существующие записи не трогаем, чтобы не затереть правки, сделанные вручную.
+func SeedNames(db *gorm.DB) error {
+	var names []models.GeoName
+	for _, country := range countries {
+		for lang, name := range country.Names {
+			names = append(names, models.GeoName{GeoCode: country.Alpha2, Lang: lang, Name: name})
+		}
+	}
+	for lang, name := range worldwideNames {
+		names = append(names, models.GeoName{GeoCode: Worldwide, Lang: lang, Name: name})
+	}
+
+	return db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(names, 200).Error
+}
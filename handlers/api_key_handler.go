@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"geo_offers/apierror"
+	"geo_offers/auth"
+	"geo_offers/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiKeyResponse - ключ API в ответах админки (без хеша)
+type apiKeyResponse struct {
+	models.APIKey
+	Scopes  []string `json:"scopes"`
+	Signing bool     `json:"signing"`
+}
+
+func newAPIKeyResponse(key models.APIKey) apiKeyResponse {
+	return apiKeyResponse{APIKey: key, Scopes: key.ScopeList(), Signing: key.SigningSecret != ""}
+}
+
+// CreateAPIKey godoc
+// @Summary Выпуск ключа API
+// @Description Создаёт ключ API с указанными правами. Открытый ключ (и секрет для HMAC-подписи, если signing=true) возвращается только в этом ответе. Требует права admin.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param body body object{name=string,scopes=[]string,expires_at=string,signing=bool} true "Параметры ключа"
+// @Success 201 {object} fiber.Map
+// @Failure 400 {object} apierror.Problem "invalid_body"
+// @Failure 400 {object} apierror.Problem "invalid_scope"
+// @Failure 401 {object} apierror.Problem "invalid_token"
+// @Failure 403 {object} apierror.Problem "insufficient_scope"
+// @Router /admin/api-keys [post]
+func CreateAPIKey(c *fiber.Ctx) error {
+	var body struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		// Signing - выпустить секрет для HMAC-подписи запросов
+		Signing bool `json:"signing"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidBody, "apikeys.invalid_body").Wrap(err)
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Scopes) == 0 {
+		return apierror.BadRequest(apierror.CodeInvalidBody, "apikeys.invalid_body")
+	}
+	for _, scope := range body.Scopes {
+		if !auth.ValidScope(scope) {
+			return apierror.BadRequest(apierror.CodeInvalidScope, "apikeys.invalid_scope", scope)
+		}
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		return apierror.BadRequest(apierror.CodeInvalidBody, "apikeys.expired_at_past")
+	}
+
+	plain, prefix, hash, err := auth.GenerateKey()
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	key := models.APIKey{
+		Name:      body.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    strings.Join(body.Scopes, " "),
+		ExpiresAt: body.ExpiresAt,
+	}
+	if body.Signing {
+		if key.SigningSecret, err = auth.GenerateSigningSecret(); err != nil {
+			return apierror.Internal(apierror.CodeInternal, err)
+		}
+	}
+	if err := db(c).Create(&key).Error; err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	response := fiber.Map{
+		"key":     plain,
+		"api_key": newAPIKeyResponse(key),
+	}
+	if key.SigningSecret != "" {
+		response["signing_secret"] = key.SigningSecret
+	}
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// ListAPIKeys godoc
+// @Summary Список ключей API
+// @Description Возвращает все ключи API, включая отозванные. Требует права admin.
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} apiKeyResponse
+// @Failure 401 {object} apierror.Problem "invalid_token"
+// @Failure 403 {object} apierror.Problem "insufficient_scope"
+// @Router /admin/api-keys [get]
+func ListAPIKeys(c *fiber.Ctx) error {
+	var keys []models.APIKey
+	if err := db(c).Order("id").Find(&keys).Error; err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	response := make([]apiKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, newAPIKeyResponse(key))
+	}
+	return c.JSON(response)
+}
+
+// RevokeAPIKey godoc
+// @Summary Отзыв ключа API
+// @Description Отзывает ключ API, после чего запросы с ним получают 401. Требует права admin.
+// @Tags Admin
+// @Param id path int true "ID ключа"
+// @Success 204
+// @Failure 401 {object} apierror.Problem "invalid_token"
+// @Failure 403 {object} apierror.Problem "insufficient_scope"
+// @Failure 404 {object} apierror.Problem "not_found"
+// @Router /admin/api-keys/{id} [delete]
+func RevokeAPIKey(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeBadRequest, "apikeys.invalid_id")
+	}
+
+	result := db(c).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return apierror.Internal(apierror.CodeInternal, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apierror.NotFound(apierror.CodeNotFound, "apikeys.not_found", id)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"strconv"
+
+	"geo_offers/auth"
+	"geo_offers/config"
+	"geo_offers/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// auditActor определяет, от чьего имени выполняется изменение, для журнала аудита
+func auditActor(c *fiber.Ctx) services.Actor {
+	actor := services.Actor{Type: "anonymous", RequestID: config.RequestIDFrom(c.UserContext())}
+
+	principal := auth.FromCtx(c)
+	if principal == nil {
+		return actor
+	}
+
+	actor.Type = principal.Type
+	switch {
+	case principal.KeyID != 0:
+		actor.ID = strconv.FormatUint(uint64(principal.KeyID), 10)
+	case principal.PartnerID != "":
+		actor.ID = principal.PartnerID
+	default:
+		actor.ID = principal.Name
+	}
+	return actor
+}
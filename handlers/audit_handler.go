@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"geo_offers/apierror"
+	"geo_offers/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// auditEventResponse - событие аудита с состоянием до/после и изменениями в виде JSON
+type auditEventResponse struct {
+	models.AuditEvent
+	Before  json.RawMessage `json:"before,omitempty"`
+	After   json.RawMessage `json:"after,omitempty"`
+	Changes json.RawMessage `json:"changes,omitempty"`
+}
+
+// GetAuditEvents godoc
+// @Summary Журнал аудита офферов
+// @Description Возвращает события журнала аудита (новые сверху) с фильтрами и пагинацией. Параметр field находит изменения конкретного поля, например rating. Требует права admin.
+// @Tags Admin
+// @Produce json
+// @Param actor_type query string false "Тип субъекта: api_key, signed_key, jwt, static_token, sync"
+// @Param actor_id query string false "ID ключа, партнёра или прогона синхронизации"
+// @Param action query string false "Действие: create, update, delete, sync_trigger"
+// @Param offer_id query int false "ExternalID оффера"
+// @Param field query string false "Изменённое поле"
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339), не включая его"
+// @Param page query int false "Номер страницы" default(1)
+// @Param limit query int false "Количество записей на страницу" default(50)
+// @Success 200 {object} fiber.Map
+// @Failure 400 {object} apierror.Problem "bad_request"
+// @Router /audit [get]
+func GetAuditEvents(c *fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	query := db(c).Model(&models.AuditEvent{})
+	for _, column := range []string{"actor_type", "actor_id", "action", "offer_id"} {
+		if value := c.Query(column); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if field := c.Query("field"); field != "" {
+		fieldJSON, _ := json.Marshal(field)
+		query = query.Where("changes LIKE ?", "%"+string(fieldJSON)+":%")
+	}
+	for param, condition := range map[string]string{"from": "created_at >= ?", "to": "created_at < ?"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		moment, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return apierror.BadRequest(apierror.CodeBadRequest, "audit.invalid_time", param)
+		}
+		query = query.Where(condition, moment)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	var events []models.AuditEvent
+	if err := query.Order("id DESC").Limit(limit).Offset((page - 1) * limit).Find(&events).Error; err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	response := make([]auditEventResponse, 0, len(events))
+	for _, event := range events {
+		response = append(response, auditEventResponse{
+			AuditEvent: event,
+			Before:     rawJSON(event.Before),
+			After:      rawJSON(event.After),
+			Changes:    rawJSON(event.Changes),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"total":       total,
+		"limit":       limit,
+		"page":        page,
+		"total_pages": (int(total) + limit - 1) / limit,
+		"events":      response,
+	})
+}
+
+func rawJSON(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	return json.RawMessage(value)
+}
@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"geo_offers/config"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// db возвращает подключение к БД с контекстом запроса, чтобы медленные запросы и ошибки БД
+// попадали в лог с request_id
+func db(c *fiber.Ctx) *gorm.DB {
+	return config.DB.WithContext(c.UserContext())
+}
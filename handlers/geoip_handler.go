@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net"
+	"os"
+
+	"geo_offers/clientip"
+	"geo_offers/config"
+	"geo_offers/geo"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Источник, по которому определён GEO в GetOffersByIP
+const (
+	geoSourceIP      = "geoip"
+	geoSourceDefault = "default"
+)
+
+// GetOffersByIP godoc
+// @Summary Получение офферов по GEO посетителя
+// @Description Определяет страну клиента по IP через локальную базу GeoIP и отдаёт тот же ответ, что и /offers/{geo}. Если страну определить не удалось, используется GEOIP_DEFAULT_GEO. Определённый GEO возвращается в поле geo и заголовках X-Resolved-Geo, X-Geo-Source.
+// @Tags Offers
+// @Produce json
+// @Param page query int false "Номер страницы" default(1)
+// @Param limit query int false "Количество записей на страницу" default(5)
+// @Success 200 {object} fiber.Map
+// @Failure 404 {object} apierror.Problem "offers_not_found"
+// @Router /offers/auto [get]
+func GetOffersByIP(c *fiber.Ctx) error {
+	target, source := resolveGeoByIP(clientip.FromCtx(c))
+
+	c.Set("X-Resolved-Geo", target.Code)
+	c.Set("X-Geo-Source", source)
+
+	return offersByGeo(c, target)
+}
+
+// resolveGeoByIP ищет страну по IP, при неудаче возвращает GEO по умолчанию
+func resolveGeoByIP(ip string) (geo.Target, string) {
+	if country, ok := lookupCountry(ip); ok {
+		if target, err := geo.Resolve(country); err == nil {
+			return target, geoSourceIP
+		}
+	}
+
+	target, err := geo.Resolve(os.Getenv("GEOIP_DEFAULT_GEO"))
+	if err != nil {
+		target, _ = geo.Resolve(geo.Worldwide)
+	}
+	return target, geoSourceDefault
+}
+
+// lookupCountry возвращает ISO-код страны по IP из базы GeoIP
+func lookupCountry(ip string) (string, bool) {
+	parsed := net.ParseIP(ip)
+	if config.GeoIP == nil || parsed == nil {
+		return "", false
+	}
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		RegisteredCountry struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"registered_country"`
+	}
+	if err := config.GeoIP.Lookup(parsed, &record); err != nil {
+		return "", false
+	}
+
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode, true
+	}
+	if record.RegisteredCountry.ISOCode != "" {
+		return record.RegisteredCountry.ISOCode, true
+	}
+	return "", false
+}
@@ -2,12 +2,18 @@
 package handlers_test
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/gofiber/fiber/v2"
@@ -16,9 +22,17 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
+	"geo_offers/apierror"
+	"geo_offers/auth"
 	"geo_offers/config"
+	"geo_offers/geo"
 	"geo_offers/handlers"
+	"geo_offers/metrics"
+	"geo_offers/middleware"
 	"geo_offers/models"
+	"geo_offers/ratelimit"
+	"geo_offers/requestlog"
+	"geo_offers/services"
 )
 
 // setupTestEnv подготавливает тестовую среду: in-memory SQLite, miniredis и Fiber-приложение с маршрутами, как в main.go.
@@ -28,9 +42,10 @@ func setupTestEnv(t *testing.T) *fiber.App {
 	assert.NoError(t, err)
 	config.DB = db
 
-	// Применяем миграцию для модели Offer
-	err = config.DB.AutoMigrate(&models.Offer{})
+	// Применяем миграцию для моделей
+	err = config.DB.AutoMigrate(&models.Offer{}, &models.GeoName{}, &models.OfferName{}, &models.APIKey{}, &models.AuditEvent{}, &models.RequestLog{})
 	assert.NoError(t, err)
+	assert.NoError(t, geo.SeedNames(config.DB))
 
 	// Настраиваем fake Redis через miniredis
 	mr, err := miniredis.Run()
@@ -41,13 +56,26 @@ func setupTestEnv(t *testing.T) *fiber.App {
 	config.RedisClient = rdb
 
 	// Создаем Fiber-приложение и регистрируем маршруты согласно main.go
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
 	app.Get("/api/v1/ping", handlers.Ping)
 	app.Get("/api/v1/health", handlers.HealthCheck)
+	app.Get("/api/v1/offers/auto", handlers.GetOffersByIP)
 	app.Get("/api/v1/offers/:geo", handlers.GetOffersByGeo)
 	app.Get("/api/v1/geo-stats", handlers.GetGeoStats)
 	app.Get("/api/v1/offers-sorted", handlers.GetAllOffersSortedByRating)
-	app.Post("/offers", handlers.CreateOffer)
+	app.Post("/offers", middleware.RequireScopes(auth.ScopeOffersWrite), handlers.CreateOffer)
+	app.Patch("/offers/:id", middleware.RequireScopes(auth.ScopeOffersWrite), handlers.UpdateOffer)
+	app.Put("/offers/:id/names/:lang", middleware.RequireScopes(auth.ScopeOffersWrite), handlers.SetOfferName)
+
+	admin := app.Group("/api/v1/admin", middleware.RequireScopes(auth.ScopeAdmin))
+	admin.Post("/api-keys", handlers.CreateAPIKey)
+	admin.Get("/api-keys", handlers.ListAPIKeys)
+	admin.Delete("/api-keys/:id", handlers.RevokeAPIKey)
+	admin.Get("/request-logs", handlers.GetRequestLogs)
+	admin.Get("/request-logs/top-geos", handlers.GetTopGeos)
+	admin.Get("/request-logs/error-rates", handlers.GetErrorRates)
+	admin.Get("/request-logs/latency", handlers.GetLatency)
+	app.Get("/api/v1/audit", middleware.RequireScopes(auth.ScopeAdmin), handlers.GetAuditEvents)
 
 	return app
 }
@@ -107,6 +135,158 @@ func TestGetOffersByGeo(t *testing.T) {
 	assert.NotEmpty(t, offers)
 }
 
+// TestGetOffersByGeoNotFound проверяет, что ошибка отдаётся в формате application/problem+json со стабильным кодом.
+func TestGetOffersByGeoNotFound(t *testing.T) {
+	app := setupTestEnv(t)
+
+	req := httptest.NewRequest("GET", "/api/v1/offers/KZ", nil)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, apierror.ContentType, resp.Header.Get("Content-Type"))
+
+	var problem apierror.Problem
+	err = json.NewDecoder(resp.Body).Decode(&problem)
+	assert.NoError(t, err)
+	assert.Equal(t, apierror.CodeOffersNotFound, problem.Code)
+	assert.Equal(t, 404, problem.Status)
+	assert.Equal(t, "/api/v1/offers/KZ", problem.Instance)
+	assert.Equal(t, "Офферы для данного ГЕО не найдены", problem.Detail)
+}
+
+// TestErrorLocalization проверяет выбор языка сообщений по Accept-Language и параметру lang.
+func TestErrorLocalization(t *testing.T) {
+	app := setupTestEnv(t)
+
+	req := httptest.NewRequest("GET", "/api/v1/offers/KZ", nil)
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9,ru;q=0.5")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var problem apierror.Problem
+	err = json.NewDecoder(resp.Body).Decode(&problem)
+	assert.NoError(t, err)
+	assert.Equal(t, "Offers not found", problem.Title)
+	assert.Equal(t, "No offers found for this GEO", problem.Detail)
+
+	// Параметр lang важнее заголовка
+	req = httptest.NewRequest("GET", "/api/v1/offers/KZ?lang=ru", nil)
+	req.Header.Set("Accept-Language", "en")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&problem)
+	assert.NoError(t, err)
+	assert.Equal(t, "Офферы не найдены", problem.Title)
+}
+
+// TestGetOffersByGeoLocalizedNames проверяет, что названия оффера и GEO отдаются на языке запроса.
+func TestGetOffersByGeoLocalizedNames(t *testing.T) {
+	app := setupTestEnv(t)
+	os.Setenv("API_TOKEN", "test-token")
+
+	offer := models.Offer{ExternalID: 7, Name: "Оффер", GeoCode: "DE", GeoName: "Германия"}
+	assert.NoError(t, config.DB.Create(&offer).Error)
+
+	req := httptest.NewRequest("PUT", "/offers/7/names/en", strings.NewReader(`{"name": "Offer"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "test-token")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	req = httptest.NewRequest("GET", "/api/v1/offers/DE", nil)
+	req.Header.Set("Accept-Language", "en")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var response struct {
+		Offers []models.Offer `json:"offers"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(t, err)
+	if assert.Len(t, response.Offers, 1) {
+		assert.Equal(t, "Offer", response.Offers[0].Name)
+		assert.Equal(t, "Germany", response.Offers[0].GeoName)
+	}
+}
+
+// TestGetOffersByGeoRegion проверяет, что регион раскрывается в страны, а офферы WW попадают в выдачу.
+func TestGetOffersByGeoRegion(t *testing.T) {
+	app := setupTestEnv(t)
+
+	offers := []models.Offer{
+		{GeoCode: "RU", ExternalID: 1, Rating: 5},
+		{GeoCode: "KZ", ExternalID: 2, Rating: 4},
+		{GeoCode: geo.Worldwide, ExternalID: 3, Rating: 3},
+		{GeoCode: "US", ExternalID: 4, Rating: 2},
+	}
+	for _, o := range offers {
+		assert.NoError(t, config.DB.Create(&o).Error)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/offers/cis", nil)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var response struct {
+		Geo    string         `json:"geo"`
+		Total  int            `json:"total"`
+		Offers []models.Offer `json:"offers"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, "CIS", response.Geo)
+	assert.Equal(t, 3, response.Total)
+}
+
+// TestGetOffersByGeoUnknown проверяет, что на неизвестный код GEO отдаётся 400.
+func TestGetOffersByGeoUnknown(t *testing.T) {
+	app := setupTestEnv(t)
+
+	req := httptest.NewRequest("GET", "/api/v1/offers/XX", nil)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 400, resp.StatusCode)
+
+	var problem apierror.Problem
+	err = json.NewDecoder(resp.Body).Decode(&problem)
+	assert.NoError(t, err)
+	assert.Equal(t, apierror.CodeUnknownGeo, problem.Code)
+}
+
+// TestGetOffersByIPFallback проверяет, что без базы GeoIP используется GEO по умолчанию.
+func TestGetOffersByIPFallback(t *testing.T) {
+	app := setupTestEnv(t)
+	os.Setenv("GEOIP_DEFAULT_GEO", "RU")
+	defer os.Unsetenv("GEOIP_DEFAULT_GEO")
+
+	offer := models.Offer{GeoCode: "RU", ExternalID: 1, Rating: 5}
+	assert.NoError(t, config.DB.Create(&offer).Error)
+
+	req := httptest.NewRequest("GET", "/api/v1/offers/auto", nil)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "RU", resp.Header.Get("X-Resolved-Geo"))
+	assert.Equal(t, "default", resp.Header.Get("X-Geo-Source"))
+
+	var response map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, "RU", response["geo"])
+}
+
 // TestGetGeoStats проверяет обработчик получения статистики по GEO.
 func TestGetGeoStats(t *testing.T) {
 	app := setupTestEnv(t)
@@ -192,3 +372,700 @@ func TestCreateOffer(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "Оффер создан успешно", response["message"])
 }
+
+// TestAPIKeyLifecycle проверяет выпуск ключа через API_TOKEN, работу с ним по схеме Bearer, проверку прав и отзыв.
+func TestAPIKeyLifecycle(t *testing.T) {
+	app := setupTestEnv(t)
+	os.Setenv("API_TOKEN", "test-token")
+
+	// Выпускаем ключ с правом offers:write
+	req := httptest.NewRequest("POST", "/api/v1/admin/api-keys", strings.NewReader(`{"name": "partner", "scopes": ["offers:write"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+
+	var created struct {
+		Key    string `json:"key"`
+		APIKey struct {
+			ID     uint     `json:"id"`
+			Scopes []string `json:"scopes"`
+		} `json:"api_key"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	assert.NotEmpty(t, created.Key)
+	assert.Equal(t, []string{"offers:write"}, created.APIKey.Scopes)
+
+	// В БД хранится только хеш ключа
+	var stored models.APIKey
+	assert.NoError(t, config.DB.First(&stored, created.APIKey.ID).Error)
+	assert.Equal(t, auth.HashKey(created.Key), stored.KeyHash)
+
+	createOffer := func(key string) int {
+		req := httptest.NewRequest("POST", "/offers", strings.NewReader(`{"external_id": 200, "geo_code": "RU"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+	assert.Equal(t, 201, createOffer(created.Key))
+
+	// Права admin у ключа нет
+	req = httptest.NewRequest("GET", "/api/v1/admin/api-keys", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Key)
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	// Отзываем ключ, после этого он не принимается
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/v1/admin/api-keys/%d", created.APIKey.ID), nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+
+	assert.Equal(t, 401, createOffer(created.Key))
+}
+
+// TestAuthorizePolicies проверяет комбинацию политик доступа: IP-allowlist или ключ с правом admin.
+func TestAuthorizePolicies(t *testing.T) {
+	app := setupTestEnv(t)
+	os.Setenv("API_TOKEN", "test-token")
+
+	policies, err := auth.ParsePolicies("ip:10.0.0.0/8 | scope:admin")
+	assert.NoError(t, err)
+	app.Get("/protected", middleware.Authorize(policies...), handlers.Ping)
+
+	// Адрес app.Test (0.0.0.0) не входит в allowlist, ключа нет
+	resp, err := app.Test(httptest.NewRequest("GET", "/protected", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+
+	req := httptest.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	_, err = auth.ParsePolicies("scope:unknown")
+	assert.Error(t, err)
+}
+
+// TestSignedCreateOffer проверяет создание оффера по HMAC-подписи и защиту от повтора и подмены тела.
+func TestSignedCreateOffer(t *testing.T) {
+	app := setupTestEnv(t)
+
+	key := models.APIKey{Name: "partner-backend", KeyHash: "unused", Scopes: auth.ScopeOffersWrite, SigningSecret: "secret"}
+	assert.NoError(t, config.DB.Create(&key).Error)
+
+	send := func(body, signedBody, nonce string) int {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req := httptest.NewRequest("POST", "/offers", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(auth.HeaderSignatureKey, strconv.Itoa(int(key.ID)))
+		req.Header.Set(auth.HeaderSignatureTimestamp, timestamp)
+		req.Header.Set(auth.HeaderSignatureNonce, nonce)
+		req.Header.Set(auth.HeaderSignature, auth.Sign("secret", "POST", "/offers", timestamp, nonce, []byte(signedBody)))
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	body := `{"external_id": 300, "geo_code": "RU"}`
+	assert.Equal(t, 201, send(body, body, "nonce-1"))
+	// Повтор того же nonce
+	assert.Equal(t, 401, send(body, body, "nonce-1"))
+	// Тело изменено после подписи
+	assert.Equal(t, 401, send(`{"external_id": 301, "geo_code": "RU"}`, body, "nonce-2"))
+}
+
+// TestAuditRatingChange проверяет, что изменение рейтинга попадает в журнал аудита с автором и значениями до/после.
+func TestAuditRatingChange(t *testing.T) {
+	app := setupTestEnv(t)
+	os.Setenv("API_TOKEN", "test-token")
+
+	key := models.APIKey{Name: "partner", KeyHash: auth.HashKey("partner-key"), Scopes: auth.ScopeOffersWrite}
+	assert.NoError(t, config.DB.Create(&key).Error)
+
+	send := func(method, url, body string) int {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer partner-key")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+	assert.Equal(t, 201, send("POST", "/offers", `{"external_id": 500, "geo_code": "RU", "rating": 1}`))
+	assert.Equal(t, 200, send("PATCH", "/offers/500", `{"rating": 7}`))
+	// Повторное сохранение без изменений не пишется в журнал
+	assert.Equal(t, 200, send("PATCH", "/offers/500", `{"rating": 7}`))
+
+	req := httptest.NewRequest("GET", "/api/v1/audit?offer_id=500&field=rating", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var response struct {
+		Total  int `json:"total"`
+		Events []struct {
+			ActorType string                                `json:"actor_type"`
+			ActorID   string                                `json:"actor_id"`
+			Action    string                                `json:"action"`
+			Changes   map[string]map[string]json.RawMessage `json:"changes"`
+		} `json:"events"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	assert.Equal(t, 2, response.Total)
+	if assert.Len(t, response.Events, 2) {
+		update := response.Events[0]
+		assert.Equal(t, "update", update.Action)
+		assert.Equal(t, auth.PrincipalAPIKey, update.ActorType)
+		assert.Equal(t, strconv.Itoa(int(key.ID)), update.ActorID)
+		assert.JSONEq(t, "1", string(update.Changes["rating"]["from"]))
+		assert.JSONEq(t, "7", string(update.Changes["rating"]["to"]))
+		assert.Equal(t, "create", response.Events[1].Action)
+	}
+}
+
+// TestRateLimitPolicies проверяет лимиты по уровням клиентов и исключение проверок здоровья из лимита.
+func TestRateLimitPolicies(t *testing.T) {
+	setupTestEnv(t)
+	os.Setenv("API_TOKEN", "test-token")
+
+	cfg := ratelimit.DefaultConfig()
+	cfg.Tiers = map[string]ratelimit.Rule{
+		ratelimit.TierAnonymous: {Limit: 2, Window: ratelimit.Duration(time.Minute)},
+		ratelimit.TierInternal:  {Limit: 0},
+	}
+	assert.NoError(t, cfg.Prepare())
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Use(middleware.RateLimiter(cfg))
+	app.Get("/api/v1/ping", handlers.Ping)
+	app.Get("/api/v1/health", handlers.HealthCheck)
+
+	get := func(path, token string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, 200, get("/api/v1/ping", ""))
+	assert.Equal(t, 200, get("/api/v1/ping", ""))
+	assert.Equal(t, 429, get("/api/v1/ping", ""))
+
+	// Проверки здоровья и внутренние клиенты не ограничиваются
+	assert.Equal(t, 200, get("/api/v1/health", ""))
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, 200, get("/api/v1/ping", "test-token"))
+	}
+}
+
+// TestRateLimitHeaders проверяет заголовки RateLimit-*, Retry-After при отказе и отчёт о квоте.
+func TestRateLimitHeaders(t *testing.T) {
+	setupTestEnv(t)
+
+	cfg := ratelimit.DefaultConfig()
+	cfg.Default = ratelimit.Rule{Limit: 3, Window: ratelimit.Duration(time.Minute)}
+	assert.NoError(t, cfg.Prepare())
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Use(middleware.RateLimiter(cfg))
+	app.Get("/api/v1/ping", handlers.Ping)
+	app.Get("/api/v1/rate-limit", handlers.GetRateLimit)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/ping", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "3", resp.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "2", resp.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", resp.Header.Get("RateLimit-Reset"))
+	assert.Equal(t, "2", resp.Header.Get("X-RateLimit-Remaining"))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/v1/rate-limit", nil))
+	assert.NoError(t, err)
+	var quota struct {
+		Tier    string `json:"tier"`
+		Limited bool   `json:"limited"`
+		Limits  []struct {
+			Name      string `json:"name"`
+			Limit     int    `json:"limit"`
+			Remaining int    `json:"remaining"`
+		} `json:"limits"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&quota))
+	assert.Equal(t, ratelimit.TierAnonymous, quota.Tier)
+	assert.True(t, quota.Limited)
+	assert.Equal(t, "default", quota.Limits[0].Name)
+	assert.Equal(t, 1, quota.Limits[0].Remaining)
+
+	_, err = app.Test(httptest.NewRequest("GET", "/api/v1/ping", nil))
+	assert.NoError(t, err)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/v1/ping", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	var problem apierror.Problem
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, apierror.CodeRateLimited, problem.Code)
+}
+
+// TestRateLimitChecksAllLimits проверяет, что отказ по лимиту клиента не расходует лимит маршрута,
+// а после серии неверных ключей запросы с ключом отклоняются без обращения к БД.
+func TestRateLimitChecksAllLimits(t *testing.T) {
+	setupTestEnv(t)
+	os.Setenv("API_TOKEN", "test-token")
+
+	var queries atomic.Int32
+	assert.NoError(t, config.DB.Callback().Query().Before("gorm:query").Register("count_queries", func(*gorm.DB) {
+		queries.Add(1)
+	}))
+
+	cfg := ratelimit.DefaultConfig()
+	cfg.Default = ratelimit.Rule{Limit: 2, Window: ratelimit.Duration(time.Minute)}
+	cfg.Auth = ratelimit.Rule{Limit: 2, Window: ratelimit.Duration(time.Minute)}
+	cfg.Routes = []ratelimit.RouteRule{{Name: "ping", Pattern: "GET /api/v1/ping", Rule: ratelimit.Rule{Limit: 5, Window: ratelimit.Duration(time.Minute)}}}
+	assert.NoError(t, cfg.Prepare())
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Use(middleware.RateLimiter(cfg))
+	app.Get("/api/v1/ping", handlers.Ping)
+
+	get := func(token string) *http.Response {
+		req := httptest.NewRequest("GET", "/api/v1/ping", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, 200, get("").StatusCode)
+	assert.Equal(t, 200, get("").StatusCode)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 429, get("").StatusCode)
+	}
+	// Отклонённые запросы не попали в окно маршрута
+	routeCount, err := config.RedisClient.ZCard(context.Background(), "ratelimit:route:ping:ip:0.0.0.0").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), routeCount)
+
+	// Неверные ключи проверяются в БД, пока не исчерпан лимит попыток с адреса
+	get("wrong-key-1")
+	get("wrong-key-2")
+	assert.Equal(t, int32(2), queries.Load())
+
+	resp := get("wrong-key-3")
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	assert.Equal(t, int32(2), queries.Load())
+}
+
+// TestRequestID проверяет, что X-Request-ID клиента возвращается в ответе и в теле ошибки,
+// а некорректный заменяется сгенерированным.
+func TestRequestID(t *testing.T) {
+	setupTestEnv(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Use(middleware.RequestID)
+	app.Get("/api/v1/offers/:geo", handlers.GetOffersByGeo)
+
+	req := httptest.NewRequest("GET", "/api/v1/offers/KZ", nil)
+	req.Header.Set("X-Request-ID", "lb-7f3a.42")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "lb-7f3a.42", resp.Header.Get("X-Request-ID"))
+
+	var problem apierror.Problem
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, "lb-7f3a.42", problem.RequestID)
+
+	req = httptest.NewRequest("GET", "/api/v1/offers/KZ", nil)
+	req.Header.Set("X-Request-ID", "bad id\twith spaces")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	generated := resp.Header.Get("X-Request-ID")
+	assert.Len(t, generated, 36)
+
+	problem = apierror.Problem{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, generated, problem.RequestID)
+}
+
+// TestRequestLogFields проверяет, что в журнал запросов попадают время обработки, строка запроса без секретов,
+// размеры, ключ API, GEO и попадание в кеш.
+func TestRequestLogFields(t *testing.T) {
+	setupTestEnv(t)
+
+	key := models.APIKey{Name: "partner", KeyHash: auth.HashKey("partner-key"), Scopes: auth.ScopeOffersRead}
+	assert.NoError(t, config.DB.Create(&key).Error)
+	assert.NoError(t, config.DB.Create(&models.Offer{GeoCode: "RU", ExternalID: 321, Rating: 5}).Error)
+
+	// Writer пишет из своей горутины: у другого соединения была бы своя in-memory база
+	sqlDB, err := config.DB.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	writer, err := requestlog.NewWriter(config.DB, requestlog.DefaultOptions())
+	assert.NoError(t, err)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Use(middleware.RequestLogger(writer))
+	app.Get("/api/v1/offers/:geo", middleware.RequireScopes(auth.ScopeOffersRead), handlers.GetOffersByGeo)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/api/v1/offers/RU?page=1&token=secret", nil)
+		req.Header.Set("Authorization", "Bearer partner-key")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+	assert.NoError(t, writer.Close(context.Background()))
+
+	var logs []models.RequestLog
+	assert.NoError(t, config.DB.Order("id").Find(&logs).Error)
+	if assert.Len(t, logs, 2) {
+		first := logs[0]
+		assert.Equal(t, "/api/v1/offers/RU", first.Endpoint)
+		assert.Equal(t, "/api/v1/offers/:geo", first.Route)
+		assert.Equal(t, "page=1&token=REDACTED", first.Query)
+		assert.Equal(t, "RU", first.Geo)
+		assert.False(t, first.CacheHit)
+		assert.Positive(t, first.LatencyMs)
+		assert.Positive(t, first.ResponseBytes)
+		if assert.NotNil(t, first.APIKeyID) {
+			assert.Equal(t, key.ID, *first.APIKeyID)
+		}
+		assert.True(t, logs[1].CacheHit)
+	}
+}
+
+// TestRequestLogAnalytics проверяет выборку журнала запросов с фильтрами и агрегаты: GEO, ошибки и время обработки.
+func TestRequestLogAnalytics(t *testing.T) {
+	app := setupTestEnv(t)
+	os.Setenv("API_TOKEN", "test-token")
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	keyID := uint(7)
+	seed := []models.RequestLog{
+		{CreatedAt: now.Add(-90 * time.Minute), Method: "GET", Endpoint: "/api/v1/offers/RU", Route: "/api/v1/offers/:geo", StatusCode: 200, LatencyMs: 10, Geo: "RU"},
+		{CreatedAt: now.Add(-80 * time.Minute), Method: "GET", Endpoint: "/api/v1/offers/RU", Route: "/api/v1/offers/:geo", StatusCode: 200, LatencyMs: 20, Geo: "RU", CacheHit: true},
+		{CreatedAt: now.Add(-70 * time.Minute), Method: "GET", Endpoint: "/api/v1/offers/KZ", Route: "/api/v1/offers/:geo", StatusCode: 404, LatencyMs: 30, Geo: "KZ"},
+		{CreatedAt: now.Add(-10 * time.Minute), Method: "POST", Endpoint: "/offers", StatusCode: 500, LatencyMs: 100, APIKeyID: &keyID},
+		{CreatedAt: now.Add(-5 * time.Minute), Method: "POST", Endpoint: "/offers", StatusCode: 201, LatencyMs: 40, APIKeyID: &keyID},
+		{CreatedAt: now.Add(-48 * time.Hour), Method: "GET", Endpoint: "/api/v1/offers/US", Route: "/api/v1/offers/:geo", StatusCode: 200, LatencyMs: 5, Geo: "US"},
+	}
+	assert.NoError(t, config.DB.Create(&seed).Error)
+
+	get := func(url string, target any) int {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if target != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(target))
+		}
+		return resp.StatusCode
+	}
+
+	var list struct {
+		Total int                 `json:"total"`
+		Logs  []models.RequestLog `json:"logs"`
+	}
+	assert.Equal(t, 200, get("/api/v1/admin/request-logs?endpoint=/api/v1/offers/*&status=2xx", &list))
+	assert.Equal(t, 3, list.Total)
+	assert.Equal(t, 200, get("/api/v1/admin/request-logs?api_key_id=7&status=500", &list))
+	if assert.Equal(t, 1, list.Total) {
+		assert.Equal(t, "/offers", list.Logs[0].Endpoint)
+	}
+	assert.Equal(t, 200, get("/api/v1/admin/request-logs?route=/api/v1/offers/:geo", &list))
+	assert.Equal(t, 4, list.Total)
+	assert.Equal(t, 400, get("/api/v1/admin/request-logs?status=9xx", nil))
+
+	var geos struct {
+		Geos []struct {
+			Geo       string `json:"geo"`
+			Requests  int    `json:"requests"`
+			CacheHits int    `json:"cache_hits"`
+		} `json:"geos"`
+	}
+	assert.Equal(t, 200, get("/api/v1/admin/request-logs/top-geos", &geos))
+	if assert.Len(t, geos.Geos, 2) {
+		assert.Equal(t, "RU", geos.Geos[0].Geo)
+		assert.Equal(t, 2, geos.Geos[0].Requests)
+		assert.Equal(t, 1, geos.Geos[0].CacheHits)
+	}
+
+	var errorRates struct {
+		Endpoints []struct {
+			Endpoint     string  `json:"endpoint"`
+			Requests     int     `json:"requests"`
+			ClientErrors int     `json:"client_errors"`
+			ServerErrors int     `json:"server_errors"`
+			ErrorRate    float64 `json:"error_rate"`
+		} `json:"endpoints"`
+	}
+	assert.Equal(t, 200, get("/api/v1/admin/request-logs/error-rates", &errorRates))
+	// Запросы к /api/v1/offers/RU и /api/v1/offers/KZ считаются одним эндпоинтом по шаблону маршрута
+	if assert.Len(t, errorRates.Endpoints, 2) {
+		assert.Equal(t, "/offers", errorRates.Endpoints[0].Endpoint)
+		assert.Equal(t, 0.5, errorRates.Endpoints[0].ErrorRate)
+		assert.Equal(t, "/api/v1/offers/:geo", errorRates.Endpoints[1].Endpoint)
+		assert.Equal(t, 3, errorRates.Endpoints[1].Requests)
+		assert.Equal(t, 1, errorRates.Endpoints[1].ClientErrors)
+	}
+
+	var latency struct {
+		SampleRate float64 `json:"sample_rate"`
+		Buckets    []struct {
+			Start    time.Time `json:"start"`
+			Requests int       `json:"requests"`
+			P50      float64   `json:"p50_ms"`
+			P95      float64   `json:"p95_ms"`
+		} `json:"buckets"`
+	}
+	from := now.Add(-2 * time.Hour).Format(time.RFC3339)
+	assert.Equal(t, 200, get("/api/v1/admin/request-logs/latency?interval=1h&from="+from, &latency))
+	if assert.Len(t, latency.Buckets, 2) {
+		assert.Equal(t, 3, latency.Buckets[0].Requests)
+		assert.Equal(t, 20.0, latency.Buckets[0].P50)
+		assert.Equal(t, 30.0, latency.Buckets[0].P95)
+		assert.Equal(t, 2, latency.Buckets[1].Requests)
+		assert.Equal(t, 100.0, latency.Buckets[1].P95)
+	}
+	assert.Equal(t, 1.0, latency.SampleRate)
+	// Сутки по минутам - больше 1000 интервалов, с 2020 года - длиннее 7 дней
+	assert.Equal(t, 400, get("/api/v1/admin/request-logs/latency?interval=1m", nil))
+	assert.Equal(t, 400, get("/api/v1/admin/request-logs/latency?interval=1h&from=2020-01-01T00:00:00Z", nil))
+}
+
+// counterValue возвращает значение счётчика с указанными метками из реестра Prometheus
+func counterValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := metrics.Registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if value, ok := labels[pair.GetName()]; ok && value != pair.GetValue() {
+					continue metrics
+				}
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// TestMetricsRouteLabels проверяет, что HTTP-метрики помечаются шаблоном маршрута и кодом ответа.
+func TestMetricsRouteLabels(t *testing.T) {
+	setupTestEnv(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Use(middleware.MetricsMiddleware)
+	app.Get("/api/v1/offers/:geo", handlers.GetOffersByGeo)
+
+	offersNotFound := map[string]string{"method": "GET", "route": "/api/v1/offers/:geo", "status": "404"}
+	unmatched := map[string]string{"method": "GET", "route": "unmatched", "status": "404"}
+	before := counterValue(t, "http_requests_total", offersNotFound)
+	beforeUnmatched := counterValue(t, "http_requests_total", unmatched)
+
+	for _, path := range []string{"/api/v1/offers/KZ", "/api/v1/offers/BY", "/api/v1/unknown"} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 404, resp.StatusCode)
+	}
+
+	assert.Equal(t, before+2, counterValue(t, "http_requests_total", offersNotFound))
+	assert.Equal(t, beforeUnmatched+1, counterValue(t, "http_requests_total", unmatched))
+}
+
+// TestMetricsRouteLabelsForMiddlewareResponses проверяет, что ответы, которые отдал middleware до обработчика
+// (401 от проверки ключа в группе, 429 от лимитера), помечаются шаблоном маршрута, а не unmatched.
+func TestMetricsRouteLabelsForMiddlewareResponses(t *testing.T) {
+	setupTestEnv(t)
+
+	cfg := ratelimit.DefaultConfig()
+	cfg.Default = ratelimit.Rule{Limit: 2, Window: ratelimit.Duration(time.Minute)}
+	assert.NoError(t, cfg.Prepare())
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Use(middleware.MetricsMiddleware)
+	app.Use(middleware.RateLimiter(cfg))
+	app.Get("/api/v1/offers/:geo", handlers.GetOffersByGeo)
+	admin := app.Group("/api/v1/admin", middleware.RequireScopes(auth.ScopeAdmin))
+	admin.Get("/request-logs", handlers.GetRequestLogs)
+
+	unauthorized := map[string]string{"method": "GET", "route": "/api/v1/admin/request-logs", "status": "401"}
+	limited := map[string]string{"method": "GET", "route": "/api/v1/offers/:geo", "status": "429"}
+	beforeUnauthorized := counterValue(t, "http_requests_total", unauthorized)
+	beforeLimited := counterValue(t, "http_requests_total", limited)
+
+	for _, request := range []struct {
+		path   string
+		status int
+	}{{"/api/v1/offers/KZ", 404}, {"/api/v1/admin/request-logs", 401}, {"/api/v1/offers/BY", 429}} {
+		resp, err := app.Test(httptest.NewRequest("GET", request.path, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, request.status, resp.StatusCode)
+	}
+
+	assert.Equal(t, beforeUnauthorized+1, counterValue(t, "http_requests_total", unauthorized))
+	assert.Equal(t, beforeLimited+1, counterValue(t, "http_requests_total", limited))
+}
+
+// TestCacheAndRateLimitMetrics проверяет счётчики попаданий в кеш и решений лимитера.
+func TestCacheAndRateLimitMetrics(t *testing.T) {
+	setupTestEnv(t)
+	assert.NoError(t, config.DB.Create(&models.Offer{GeoCode: "DE", ExternalID: 77, Rating: 1}).Error)
+
+	cfg := ratelimit.DefaultConfig()
+	cfg.Default = ratelimit.Rule{Limit: 2, Window: ratelimit.Duration(time.Minute)}
+	assert.NoError(t, cfg.Prepare())
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Use(middleware.RateLimiter(cfg))
+	app.Get("/api/v1/offers/:geo", handlers.GetOffersByGeo)
+
+	hit := map[string]string{"route": "/api/v1/offers/:geo", "result": "hit"}
+	miss := map[string]string{"route": "/api/v1/offers/:geo", "result": "miss"}
+	blocked := map[string]string{"policy": "default", "result": "blocked"}
+	hitsBefore := counterValue(t, "cache_requests_total", hit)
+	missesBefore := counterValue(t, "cache_requests_total", miss)
+	blockedBefore := counterValue(t, "ratelimit_decisions_total", blocked)
+
+	for _, status := range []int{200, 200, 429} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/offers/DE", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, status, resp.StatusCode)
+	}
+
+	assert.Equal(t, missesBefore+1, counterValue(t, "cache_requests_total", miss))
+	assert.Equal(t, hitsBefore+1, counterValue(t, "cache_requests_total", hit))
+	assert.Equal(t, blockedBefore+1, counterValue(t, "ratelimit_decisions_total", blocked))
+}
+
+// TestSyncOffers проверяет, что синхронизация считает только реально изменённые офферы, пишет в аудит
+// не больше одного события на оффер и деактивирует офферы, которых больше нет в выдаче, но только после полной загрузки.
+func TestSyncOffers(t *testing.T) {
+	app := setupTestEnv(t)
+	assert.NoError(t, config.DB.Create([]models.Offer{
+		{ExternalID: 1, Name: "Same", Currency: "RUB", GeoCode: "RU", GeoName: "Russia", Rating: 1000},
+		{ExternalID: 2, Name: "Changed", Currency: "RUB", GeoCode: "RU", GeoName: "Russia", Rating: 1},
+		{ExternalID: 3, Name: "Gone", Currency: "KZT", GeoCode: "KZ", GeoName: "Kazakhstan", Rating: 1},
+	}).Error)
+
+	var failing atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.URL.Query().Get("page") != "1" {
+			fmt.Fprint(w, `{"offers": []}`)
+			return
+		}
+		offer := `{"id": "%d", "name": "%s", "offer_currency": {"name": "RUB"}, "approval_time": "0", "payment_time": "0",
+			"geo": [%s], "stat": {"ecpl": "1"}}`
+		russia := `{"code": "RU", "name": "Russia"}`
+		// У нового оффера несколько GEO, в том числе повтор в другом написании
+		multiGeo := russia + `, {"code": "KZ", "name": "Kazakhstan"}, {"code": "ru", "name": "Russia"}`
+		fmt.Fprintf(w, `{"offers": [%s, %s, %s]}`,
+			fmt.Sprintf(offer, 1, "Same", russia), fmt.Sprintf(offer, 2, "Changed", russia), fmt.Sprintf(offer, 4, "New", multiGeo))
+	}))
+	defer upstream.Close()
+	t.Setenv("API_URL", upstream.URL)
+
+	synced := func() map[string]float64 {
+		counts := map[string]float64{}
+		for _, action := range []string{"created", "updated", "deactivated"} {
+			counts[action] = counterValue(t, "sync_offers_total", map[string]string{"action": action})
+		}
+		return counts
+	}
+
+	before := synced()
+	services.RunSync("run-1")
+	after := synced()
+	assert.Equal(t, 1.0, after["created"]-before["created"])
+	assert.Equal(t, 1.0, after["updated"]-before["updated"])
+	assert.Equal(t, 1.0, after["deactivated"]-before["deactivated"])
+
+	var multiGeo models.Offer
+	assert.NoError(t, config.DB.First(&multiGeo, 4).Error)
+	assert.Equal(t, "RU", multiGeo.GeoCode)
+	auditEvents := func(runID string, offerID int) int64 {
+		var count int64
+		config.DB.Model(&models.AuditEvent{}).Where("actor_id = ? AND offer_id = ?", runID, offerID).Count(&count)
+		return count
+	}
+	assert.Equal(t, int64(1), auditEvents("run-1", 4))
+
+	var gone models.Offer
+	assert.NoError(t, config.DB.First(&gone, 3).Error)
+	assert.NotNil(t, gone.DeactivatedAt)
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/offers/KZ", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	// Повторный прогон с той же выдачей ничего не меняет
+	before = after
+	services.RunSync("run-2")
+	assert.Equal(t, before, synced())
+	var run2Events int64
+	config.DB.Model(&models.AuditEvent{}).Where("actor_id = ?", "run-2").Count(&run2Events)
+	assert.Zero(t, run2Events)
+
+	// Если выдача не загрузилась, офферы не деактивируются
+	failing.Store(true)
+	services.RunSync("run-3")
+	var active int64
+	config.DB.Model(&models.Offer{}).Where("deactivated_at IS NULL").Count(&active)
+	assert.Equal(t, int64(3), active)
+}
+
+// TestMetricsHandler проверяет выбор формата по Accept и сжатие ответа с метриками.
+func TestMetricsHandler(t *testing.T) {
+	app := fiber.New()
+	app.Get("/api/v1/metrics", middleware.MetricsHandler())
+
+	req := httptest.NewRequest("GET", "/api/v1/metrics", nil)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain"))
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "go_goroutines")
+	assert.Contains(t, string(body), "http_requests_in_flight")
+
+	req = httptest.NewRequest("GET", "/api/v1/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "application/openmetrics-text"))
+	body, err = io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(body), "# EOF\n"))
+
+	req = httptest.NewRequest("GET", "/api/v1/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"geo_offers/apierror"
 	"geo_offers/config"
 	"github.com/gofiber/fiber/v2"
 )
@@ -10,16 +11,10 @@ func HealthCheck(c *fiber.Ctx) error {
 	// Проверка подключения к базе данных
 	sqlDB, err := config.DB.DB()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Ошибка получения подключения к БД",
-		})
+		return apierror.New(fiber.StatusInternalServerError, apierror.CodeDBUnavailable, "health.db_connection").Wrap(err)
 	}
 	if err = sqlDB.Ping(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Пинг БД не прошёл",
-		})
+		return apierror.New(fiber.StatusInternalServerError, apierror.CodeDBUnavailable, "health.db_ping").Wrap(err)
 	}
 
 	// При желании можно добавить проверку других сервисов (например, Redis)
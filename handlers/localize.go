@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"geo_offers/models"
+	"gorm.io/gorm"
+)
+
+// localizeOffers подставляет в офферы названия на языке запроса:
+// переопределённые названия офферов и названия GEO из справочника.
+// Если перевода нет, остаётся то, что пришло из CityAds.
+func localizeOffers(tx *gorm.DB, offers []models.Offer, lang string) {
+	if len(offers) == 0 {
+		return
+	}
+
+	ids := make([]int, 0, len(offers))
+	codes := make([]string, 0, len(offers))
+	for _, offer := range offers {
+		ids = append(ids, offer.ExternalID)
+		codes = append(codes, offer.GeoCode)
+	}
+
+	var offerNames []models.OfferName
+	tx.Where("offer_id IN ? AND lang = ?", ids, lang).Find(&offerNames)
+	nameByOffer := make(map[int]string, len(offerNames))
+	for _, n := range offerNames {
+		nameByOffer[n.OfferID] = n.Name
+	}
+
+	var geoNames []models.GeoName
+	tx.Where("geo_code IN ? AND lang = ?", codes, lang).Find(&geoNames)
+	nameByGeo := make(map[string]string, len(geoNames))
+	for _, n := range geoNames {
+		nameByGeo[n.GeoCode] = n.Name
+	}
+
+	for i := range offers {
+		if name, ok := nameByOffer[offers[i].ExternalID]; ok {
+			offers[i].Name = name
+		}
+		if name, ok := nameByGeo[offers[i].GeoCode]; ok {
+			offers[i].GeoName = name
+		}
+	}
+}
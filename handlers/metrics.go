@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"geo_offers/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var cacheRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Обращения к кешу выдачи в Redis по маршрутам: hit или miss",
+	},
+	[]string{"route", "result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(cacheRequests)
+}
+
+// observeCache учитывает обращение к кешу. Маршрут - шаблон, как в HTTP-метриках.
+func observeCache(c *fiber.Ctx, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.WithLabelValues(c.Route().Path, result).Inc()
+}
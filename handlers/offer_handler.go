@@ -1,31 +1,51 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
+	"geo_offers/apierror"
 	"geo_offers/config"
+	"geo_offers/geo"
+	"geo_offers/i18n"
 	"geo_offers/models"
+	"geo_offers/requestlog"
+	"geo_offers/services"
 	"github.com/gofiber/fiber/v2"
-	"os"
+	"gorm.io/gorm"
+	"log/slog"
 	"strconv"
 	"time"
 )
 
 // GetOffersByGeo godoc
 // @Summary Получение офферов по GEO
-// @Description Возвращает офферы для указанного GEO с пагинацией и кешированием.
+// @Description Возвращает офферы для указанного GEO с пагинацией и кешированием. Названия офферов и GEO отдаются на языке из Accept-Language. Деактивированные офферы не отдаются.
 // @Tags Offers
 // @Accept json
 // @Produce json
-// @Param geo path string true "GEO код"
+// @Param geo path string true "GEO код: ISO alpha-2/alpha-3, алиас (UK), регион (EU, CIS, LATAM) или WW"
 // @Param page query int false "Номер страницы" default(1)
 // @Param limit query int false "Количество записей на страницу" default(5)
 // @Success 200 {object} fiber.Map
-// @Failure 404 {object} fiber.Map{"error": "Офферы для данного ГЕО не найдены"}
+// @Failure 400 {object} apierror.Problem "unknown_geo"
+// @Failure 404 {object} apierror.Problem "offers_not_found"
 // @Router /offers/{geo} [get]
 func GetOffersByGeo(c *fiber.Ctx) error {
-	geo := c.Params("geo")
+	target, err := geo.Resolve(c.Params("geo"))
+	if err != nil {
+		return apierror.BadRequest(apierror.CodeUnknownGeo, "geo.unknown", c.Params("geo"))
+	}
+
+	return offersByGeo(c, target)
+}
+
+// offersByGeo отдаёт выдачу офферов по уже разобранному GEO
+func offersByGeo(c *fiber.Ctx, target geo.Target) error {
+	// Офферы на весь мир подходят для любой страны и региона
+	geoCodes := target.Countries
+	if target.Code != geo.Worldwide {
+		geoCodes = append([]string{geo.Worldwide}, geoCodes...)
+	}
 
 	// Здесь получаем параметры пагинации
 	limit, err := strconv.Atoi(c.Query("limit", "5"))
@@ -43,45 +63,58 @@ func GetOffersByGeo(c *fiber.Ctx) error {
 
 	offset := (page - 1) * limit
 
-	// Здесь генерируем ключ для кеша
-	cacheKey := fmt.Sprintf("offers:%s:page:%d:limit:%d", geo, page, limit)
+	// GEO попадёт во все записи лога по этому запросу, включая итоговую запись middleware
+	c.SetUserContext(config.WithLogAttrs(c.UserContext(), slog.String("geo", target.Code)))
+	c.Locals(requestlog.GeoKey, target.Code)
+
+	// Здесь генерируем ключ для кеша, названия в ответе зависят от языка
+	lang := i18n.Lang(c)
+	cacheKey := fmt.Sprintf("offers:%s:page:%d:limit:%d:lang:%s", target.Code, page, limit, lang)
 
 	// Проверка кеша
-	cachedData, err := config.RedisClient.Get(context.Background(), cacheKey).Result()
+	cachedData, err := config.RedisClient.Get(c.UserContext(), cacheKey).Result()
+	observeCache(c, err == nil)
 	if err == nil {
-		fmt.Println("Данные загружены из кеша")
+		config.Log("handlers").DebugContext(c.UserContext(), "Данные загружены из кеша", "key", cacheKey)
+		c.Locals(requestlog.CacheHitKey, true)
 		return c.SendString(cachedData)
 	}
 
 	// Здесь данные качаем из БД
 	var offers []models.Offer
-	config.DB.Where("geo_code = ?", geo).Order("rating DESC").Limit(limit).Offset(offset).Find(&offers)
+	db(c).Where("geo_code IN ? AND deactivated_at IS NULL", geoCodes).Order("rating DESC").Limit(limit).Offset(offset).Find(&offers)
 
 	var total int64
-	config.DB.Model(&models.Offer{}).Where("geo_code = ?", geo).Count(&total)
+	db(c).Model(&models.Offer{}).Where("geo_code IN ? AND deactivated_at IS NULL", geoCodes).Count(&total)
 
 	if len(offers) == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Офферы для данного ГЕО не найдены"})
+		return apierror.NotFound(apierror.CodeOffersNotFound, "offers.not_found_for_geo")
 	}
 
+	localizeOffers(db(c), offers, lang)
+
 	response := fiber.Map{
+		"geo":         target.Code,
 		"total":       total,
 		"limit":       limit,
 		"page":        page,
 		"total_pages": (int(total) + limit - 1) / limit,
 		"offers":      offers,
 	}
+	if target.Region {
+		response["countries"] = target.Countries
+	}
 
 	// Здесь сохраняем кеш на 10 минут
 	data, _ := json.Marshal(response)
-	config.RedisClient.Set(context.Background(), cacheKey, data, 10*time.Minute)
+	config.RedisClient.Set(c.UserContext(), cacheKey, data, 10*time.Minute)
 
 	return c.JSON(response)
 }
 
 // GetGeoStats godoc
 // @Summary Получение статистики по GEO
-// @Description Возвращает статистику офферов для каждого GEO.
+// @Description Возвращает число активных офферов для каждого GEO.
 // @Tags Offers
 // @Produce json
 // @Success 200 {object} []struct{GeoCode string; Count int}
@@ -92,21 +125,21 @@ func GetGeoStats(c *fiber.Ctx) error {
 		Count   int    `json:"count"`
 	}
 
-	config.DB.Raw("SELECT geo_code, COUNT(*) as count FROM offers GROUP BY geo_code").Scan(&stats)
+	db(c).Raw("SELECT geo_code, COUNT(*) as count FROM offers WHERE deactivated_at IS NULL GROUP BY geo_code").Scan(&stats)
 
 	return c.JSON(stats)
 }
 
 // GetAllOffersSortedByRating godoc
 // @Summary Получение всех офферов, отсортированных по рейтингу
-// @Description Возвращает все офферы, отсортированные по убыванию рейтинга, с пагинацией и кешированием.
+// @Description Возвращает все офферы, отсортированные по убыванию рейтинга, с пагинацией и кешированием. Названия офферов и GEO отдаются на языке из Accept-Language. Деактивированные офферы не отдаются.
 // @Tags Offers
 // @Accept json
 // @Produce json
 // @Param page query int false "Номер страницы" default(1)
 // @Param limit query int false "Количество записей на страницу" default(5)
 // @Success 200 {object} fiber.Map
-// @Failure 404 {object} fiber.Map{"error": "Офферы не найдены"}
+// @Failure 404 {object} apierror.Problem "offers_not_found"
 // @Router /offers-sorted [get]
 func GetAllOffersSortedByRating(c *fiber.Ctx) error {
 	// Получаем параметры пагинации
@@ -125,27 +158,32 @@ func GetAllOffersSortedByRating(c *fiber.Ctx) error {
 
 	offset := (page - 1) * limit
 
-	// Здесь генерируем ключ для кеша
-	cacheKey := fmt.Sprintf("offers_sorted:page:%d:limit:%d", page, limit)
+	// Здесь генерируем ключ для кеша, названия в ответе зависят от языка
+	lang := i18n.Lang(c)
+	cacheKey := fmt.Sprintf("offers_sorted:page:%d:limit:%d:lang:%s", page, limit, lang)
 
 	// Проверка кеша
-	cachedData, err := config.RedisClient.Get(context.Background(), cacheKey).Result()
+	cachedData, err := config.RedisClient.Get(c.UserContext(), cacheKey).Result()
+	observeCache(c, err == nil)
 	if err == nil {
-		fmt.Println("Данные загружены из кеша")
+		config.Log("handlers").DebugContext(c.UserContext(), "Данные загружены из кеша", "key", cacheKey)
+		c.Locals(requestlog.CacheHitKey, true)
 		return c.SendString(cachedData)
 	}
 
 	var offers []models.Offer
 
-	config.DB.Order("rating DESC").Limit(limit).Offset(offset).Find(&offers)
+	db(c).Where("deactivated_at IS NULL").Order("rating DESC").Limit(limit).Offset(offset).Find(&offers)
 
 	var total int64
-	config.DB.Model(&models.Offer{}).Count(&total)
+	db(c).Model(&models.Offer{}).Where("deactivated_at IS NULL").Count(&total)
 
 	if len(offers) == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Офферы не найдены"})
+		return apierror.NotFound(apierror.CodeOffersNotFound, "offers.not_found")
 	}
 
+	localizeOffers(db(c), offers, lang)
+
 	response := fiber.Map{
 		"total":       total,
 		"limit":       limit,
@@ -156,50 +194,170 @@ func GetAllOffersSortedByRating(c *fiber.Ctx) error {
 
 	// Здесь сохраняем кеш на 10 минут
 	data, _ := json.Marshal(response)
-	config.RedisClient.Set(context.Background(), cacheKey, data, 10*time.Minute)
+	config.RedisClient.Set(c.UserContext(), cacheKey, data, 10*time.Minute)
 
 	return c.JSON(response)
 }
 
 // CreateOffer godoc
 // @Summary Создание нового оффера
-// @Description Создает новый оффер. Требует авторизации через API-токен.
+// @Description Создает новый оффер. Требует ключ API с правом offers:write.
 // @Tags Offers
 // @Accept json
 // @Produce json
 // @Param offer body models.Offer true "Параметры оффера"
 // @Success 201 {object} fiber.Map
-// @Failure 400 {object} fiber.Map{"error": "Ошибка парсинга данных"}
-// @Failure 401 {object} fiber.Map{"error": "Доступ запрещён. Неверный API-токен."}
-// @Failure 409 {object} fiber.Map{"error": "Оффер с таким ExternalID уже существует"}
+// @Failure 400 {object} apierror.Problem "invalid_body"
+// @Failure 400 {object} apierror.Problem "unknown_geo"
+// @Failure 401 {object} apierror.Problem "invalid_token"
+// @Failure 403 {object} apierror.Problem "insufficient_scope"
+// @Failure 409 {object} apierror.Problem "offer_exists"
 // @Router /offers [post]
 func CreateOffer(c *fiber.Ctx) error {
-	// Здесь проверяем апи токен (самая простая реализация)
-	apiToken := c.Get("Authorization")
-	expectedToken := os.Getenv("API_TOKEN")
-
-	if apiToken == "" || apiToken != expectedToken {
-		return c.Status(401).JSON(fiber.Map{"error": "Доступ запрещён. Неверный API-токен."})
-	}
-
 	var offer models.Offer
 
 	if err := c.BodyParser(&offer); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Ошибка парсинга данных"})
+		return apierror.BadRequest(apierror.CodeInvalidBody, "offers.invalid_body").Wrap(err)
+	}
+
+	geoCode, ok := geo.Normalize(offer.GeoCode)
+	if !ok {
+		return apierror.BadRequest(apierror.CodeUnknownGeo, "geo.unknown", offer.GeoCode)
 	}
+	offer.GeoCode = geoCode
 
 	var existingOffer models.Offer
-	result := config.DB.Where("external_id = ?", offer.ExternalID).First(&existingOffer)
+	result := db(c).Where("external_id = ?", offer.ExternalID).First(&existingOffer)
 
 	if result.RowsAffected > 0 {
-		return c.Status(409).JSON(fiber.Map{"error": "Оффер с таким ExternalID уже существует"})
+		return apierror.Conflict(apierror.CodeOfferExists, "offers.already_exists")
+	}
+
+	// Здесь сохраняем оффер вместе с записью в журнал аудита
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&offer).Error; err != nil {
+			return err
+		}
+		_, err := services.RecordAudit(tx, auditActor(c), services.AuditCreate, offer.ExternalID, nil, offer)
+		return err
+	})
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
 	}
 
-	// Здесь сохраняем оффер
-	config.DB.Create(&offer)
+	services.ClearOfferCache(c.UserContext(), offer.GeoCode)
 
 	return c.Status(201).JSON(fiber.Map{
-		"message": "Оффер создан успешно",
+		"message": i18n.T(i18n.Lang(c), "offers.created"),
+		"offer":   offer,
+	})
+}
+
+// UpdateOffer godoc
+// @Summary Изменение оффера
+// @Description Меняет переданные поля оффера (external_id менять нельзя). Изменение пишется в журнал аудита. Требует ключ API с правом offers:write.
+// @Tags Offers
+// @Accept json
+// @Produce json
+// @Param id path int true "ExternalID оффера"
+// @Param offer body models.Offer true "Изменяемые поля оффера"
+// @Success 200 {object} fiber.Map
+// @Failure 400 {object} apierror.Problem "invalid_body"
+// @Failure 400 {object} apierror.Problem "unknown_geo"
+// @Failure 401 {object} apierror.Problem "invalid_token"
+// @Failure 403 {object} apierror.Problem "insufficient_scope"
+// @Failure 404 {object} apierror.Problem "not_found"
+// @Router /offers/{id} [patch]
+func UpdateOffer(c *fiber.Ctx) error {
+	before, err := findOffer(c)
+	if err != nil {
+		return err
+	}
+
+	// Поля, которых нет в теле, остаются прежними
+	offer := before
+	if err := c.BodyParser(&offer); err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidBody, "offers.invalid_body").Wrap(err)
+	}
+	offer.ExternalID = before.ExternalID
+
+	geoCode, ok := geo.Normalize(offer.GeoCode)
+	if !ok {
+		return apierror.BadRequest(apierror.CodeUnknownGeo, "geo.unknown", offer.GeoCode)
+	}
+	offer.GeoCode = geoCode
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&offer).Error; err != nil {
+			return err
+		}
+		_, err := services.RecordAudit(tx, auditActor(c), services.AuditUpdate, offer.ExternalID, before, offer)
+		return err
+	})
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	services.ClearOfferCache(c.UserContext(), before.GeoCode)
+	if offer.GeoCode != before.GeoCode {
+		services.ClearOfferCache(c.UserContext(), offer.GeoCode)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": i18n.T(i18n.Lang(c), "offers.updated"),
 		"offer":   offer,
 	})
 }
+
+// DeleteOffer godoc
+// @Summary Удаление оффера
+// @Description Удаляет оффер вместе с переопределёнными названиями. Удаление пишется в журнал аудита. Требует ключ API с правом offers:write.
+// @Tags Offers
+// @Param id path int true "ExternalID оффера"
+// @Success 204
+// @Failure 401 {object} apierror.Problem "invalid_token"
+// @Failure 403 {object} apierror.Problem "insufficient_scope"
+// @Failure 404 {object} apierror.Problem "not_found"
+// @Router /offers/{id} [delete]
+func DeleteOffer(c *fiber.Ctx) error {
+	offer, err := findOffer(c)
+	if err != nil {
+		return err
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("offer_id = ?", offer.ExternalID).Delete(&models.OfferName{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&offer).Error; err != nil {
+			return err
+		}
+		_, err := services.RecordAudit(tx, auditActor(c), services.AuditDelete, offer.ExternalID, offer, nil)
+		return err
+	})
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	services.ClearOfferCache(c.UserContext(), offer.GeoCode)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// findOffer находит оффер по ExternalID из параметра маршрута :id
+func findOffer(c *fiber.Ctx) (models.Offer, error) {
+	var offer models.Offer
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return offer, apierror.BadRequest(apierror.CodeBadRequest, "offers.invalid_id")
+	}
+
+	result := db(c).Where("external_id = ?", id).Limit(1).Find(&offer)
+	if result.Error != nil {
+		return offer, apierror.Internal(apierror.CodeInternal, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return offer, apierror.NotFound(apierror.CodeNotFound, "offers.offer_not_found", id)
+	}
+	return offer, nil
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"geo_offers/apierror"
+	"geo_offers/i18n"
+	"geo_offers/models"
+	"geo_offers/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"slices"
+	"strings"
+)
+
+// SetOfferName godoc
+// @Summary Переопределение названия оффера на языке
+// @Description Сохраняет название оффера для указанного языка. Требует ключ API с правом offers:write.
+// @Tags Offers
+// @Accept json
+// @Produce json
+// @Param id path int true "ExternalID оффера"
+// @Param lang path string true "Код языка"
+// @Param body body object{name=string} true "Название"
+// @Success 200 {object} models.OfferName
+// @Failure 400 {object} apierror.Problem "invalid_body"
+// @Failure 401 {object} apierror.Problem "invalid_token"
+// @Failure 403 {object} apierror.Problem "insufficient_scope"
+// @Failure 404 {object} apierror.Problem "not_found"
+// @Router /offers/{id}/names/{lang} [put]
+func SetOfferName(c *fiber.Ctx) error {
+	offer, lang, err := offerNameTarget(c)
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Name) == "" {
+		return apierror.BadRequest(apierror.CodeInvalidBody, "offers.invalid_body")
+	}
+
+	before := currentOfferName(db(c), offer.ExternalID, lang)
+	offerName := models.OfferName{OfferID: offer.ExternalID, Lang: lang, Name: strings.TrimSpace(body.Name)}
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&offerName).Error; err != nil {
+			return err
+		}
+		_, err := services.RecordAudit(tx, auditActor(c), services.AuditUpdate, offer.ExternalID,
+			nameAuditState(lang, before), nameAuditState(lang, &offerName.Name))
+		return err
+	})
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	services.ClearOfferCache(c.UserContext(), offer.GeoCode)
+	return c.JSON(offerName)
+}
+
+// DeleteOfferName godoc
+// @Summary Удаление переопределённого названия оффера
+// @Description Удаляет название оффера для указанного языка, после чего отдаётся исходное название. Требует ключ API с правом offers:write.
+// @Tags Offers
+// @Param id path int true "ExternalID оффера"
+// @Param lang path string true "Код языка"
+// @Success 204
+// @Failure 401 {object} apierror.Problem "invalid_token"
+// @Failure 403 {object} apierror.Problem "insufficient_scope"
+// @Failure 404 {object} apierror.Problem "not_found"
+// @Router /offers/{id}/names/{lang} [delete]
+func DeleteOfferName(c *fiber.Ctx) error {
+	offer, lang, err := offerNameTarget(c)
+	if err != nil {
+		return err
+	}
+
+	before := currentOfferName(db(c), offer.ExternalID, lang)
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("offer_id = ? AND lang = ?", offer.ExternalID, lang).Delete(&models.OfferName{}).Error; err != nil {
+			return err
+		}
+		_, err := services.RecordAudit(tx, auditActor(c), services.AuditUpdate, offer.ExternalID,
+			nameAuditState(lang, before), nameAuditState(lang, nil))
+		return err
+	})
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	services.ClearOfferCache(c.UserContext(), offer.GeoCode)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// currentOfferName возвращает текущее переопределённое название или nil
+func currentOfferName(tx *gorm.DB, offerID int, lang string) *string {
+	var offerName models.OfferName
+	result := tx.Where("offer_id = ? AND lang = ?", offerID, lang).Limit(1).Find(&offerName)
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	return &offerName.Name
+}
+
+// nameAuditState - состояние переопределённого названия для журнала аудита: поле name_<lang>
+func nameAuditState(lang string, name *string) map[string]any {
+	state := map[string]any{}
+	if name != nil {
+		state["name_"+lang] = *name
+	}
+	return state
+}
+
+// offerNameTarget находит оффер и проверяет язык из параметров маршрута
+func offerNameTarget(c *fiber.Ctx) (models.Offer, string, error) {
+	lang := strings.ToLower(c.Params("lang"))
+	if !slices.Contains(i18n.Supported(), lang) {
+		return models.Offer{}, "", apierror.BadRequest(apierror.CodeUnsupportedLanguage, "i18n.unsupported_language", lang)
+	}
+
+	offer, err := findOffer(c)
+	if err != nil {
+		return offer, "", err
+	}
+
+	return offer, lang, nil
+}
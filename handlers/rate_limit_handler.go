@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"time"
+
+	"geo_offers/ratelimit"
+	"github.com/gofiber/fiber/v2"
+)
+
+// quotaLimit - состояние одного лимита в ответе GetRateLimit
+type quotaLimit struct {
+	Name          string `json:"name"`
+	Limit         int    `json:"limit"`
+	Remaining     int    `json:"remaining"`
+	WindowSeconds int    `json:"window_seconds"`
+	ResetSeconds  int    `json:"reset_seconds"`
+}
+
+// GetRateLimit @Summary Get caller's rate limit quota
+// @Description Returns the rate limits applied to the caller (by API key, tier or IP) and how many requests are left. The request itself is counted.
+// @Tags RateLimit
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /rate-limit [get]
+func GetRateLimit(c *fiber.Ctx) error {
+	quota, _ := c.Locals(ratelimit.LocalsKey).(*ratelimit.Quota)
+	if quota == nil {
+		// Ограничение запросов не подключено к этому маршруту
+		return c.JSON(fiber.Map{"limited": false, "limits": []quotaLimit{}})
+	}
+
+	limits := make([]quotaLimit, 0, len(quota.Limits))
+	for _, status := range quota.Limits {
+		limits = append(limits, quotaLimit{
+			Name:          status.Name,
+			Limit:         status.Result.Limit,
+			Remaining:     status.Remaining,
+			WindowSeconds: int(time.Duration(status.Window) / time.Second),
+			ResetSeconds:  int((status.ResetAfter + time.Second - 1) / time.Second),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"tier":    quota.Tier,
+		"subject": quota.Subject,
+		"limited": !quota.Exempt && len(limits) > 0,
+		// degraded - Redis недоступен, лимиты считаются по режиму отказа
+		"degraded": quota.Degraded,
+		"limits":   limits,
+	})
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"geo_offers/apierror"
+	"geo_offers/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Ограничения GetLatency: записи читаются в память, поэтому период и число строк ограничены
+const (
+	// maxLatencyBuckets - больше интервалов за один запрос не считаем
+	maxLatencyBuckets = 1000
+	// maxLatencyPeriod - самый длинный период, за который считаются перцентили
+	maxLatencyPeriod = 7 * 24 * time.Hour
+	// maxLatencySamples - если записей за период больше, перцентили считаются по равномерной выборке
+	maxLatencySamples = 100000
+)
+
+// GetRequestLogs godoc
+// @Summary Журнал запросов
+// @Description Возвращает записи журнала запросов (новые сверху) с фильтрами и пагинацией. Требует права admin.
+// @Tags Admin
+// @Produce json
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339), не включая его"
+// @Param endpoint query string false "Путь запроса; * в конце ищет по префиксу, например /api/v1/offers/*"
+// @Param route query string false "Шаблон маршрута, например /api/v1/offers/:geo"
+// @Param method query string false "HTTP-метод"
+// @Param status query string false "Код ответа (404) или класс (4xx)"
+// @Param ip query string false "IP клиента"
+// @Param api_key_id query int false "ID ключа API"
+// @Param geo query string false "GEO выдачи"
+// @Param request_id query string false "X-Request-ID"
+// @Param page query int false "Номер страницы" default(1)
+// @Param limit query int false "Количество записей на страницу" default(50)
+// @Success 200 {object} fiber.Map
+// @Failure 400 {object} apierror.Problem "bad_request"
+// @Router /admin/request-logs [get]
+func GetRequestLogs(c *fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	query, _, _, err := filterRequestLogs(c, false)
+	if err != nil {
+		return err
+	}
+	if requestID := c.Query("request_id"); requestID != "" {
+		query = query.Where("request_id = ?", requestID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	var logs []models.RequestLog
+	if err := query.Order("id DESC").Limit(limit).Offset((page - 1) * limit).Find(&logs).Error; err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"total":       total,
+		"limit":       limit,
+		"page":        page,
+		"total_pages": (int(total) + limit - 1) / limit,
+		"logs":        logs,
+	})
+}
+
+// geoStat - сколько раз запрашивали GEO
+type geoStat struct {
+	Geo       string `json:"geo"`
+	Requests  int64  `json:"requests"`
+	CacheHits int64  `json:"cache_hits"`
+}
+
+// GetTopGeos godoc
+// @Summary Самые запрашиваемые GEO
+// @Description Возвращает GEO и регионы по числу запросов офферов за период (по умолчанию - последние сутки) и долю ответов из кеша. Принимает те же фильтры, что и /admin/request-logs. Требует права admin.
+// @Tags Admin
+// @Produce json
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339), не включая его"
+// @Param limit query int false "Сколько GEO вернуть" default(10)
+// @Success 200 {object} fiber.Map
+// @Failure 400 {object} apierror.Problem "bad_request"
+// @Router /admin/request-logs/top-geos [get]
+func GetTopGeos(c *fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limit < 1 || limit > 250 {
+		limit = 10
+	}
+
+	query, from, to, err := filterRequestLogs(c, true)
+	if err != nil {
+		return err
+	}
+
+	var stats []geoStat
+	err = query.
+		Select("geo, COUNT(*) AS requests, SUM(CASE WHEN cache_hit THEN 1 ELSE 0 END) AS cache_hits").
+		Where("geo <> ''").
+		Group("geo").
+		Order("requests DESC, geo").
+		Limit(limit).
+		Scan(&stats).Error
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+	if stats == nil {
+		stats = []geoStat{}
+	}
+
+	return c.JSON(fiber.Map{"from": from, "to": to, "geos": stats})
+}
+
+// endpointErrors - ошибки эндпоинта за период. Эндпоинт - шаблон маршрута, у старых записей без шаблона - путь.
+type endpointErrors struct {
+	Method       string  `json:"method"`
+	Endpoint     string  `json:"endpoint"`
+	Requests     int64   `json:"requests"`
+	ClientErrors int64   `json:"client_errors"`
+	ServerErrors int64   `json:"server_errors"`
+	ErrorRate    float64 `json:"error_rate" gorm:"-"`
+}
+
+// GetErrorRates godoc
+// @Summary Доля ошибок по эндпоинтам
+// @Description Возвращает число запросов, ответов 4xx и 5xx и долю 5xx по эндпоинтам (шаблонам маршрутов, например /api/v1/offers/:geo) за период (по умолчанию - последние сутки), сначала эндпоинты с наибольшим числом 5xx. Принимает те же фильтры, что и /admin/request-logs. Требует права admin.
+// @Tags Admin
+// @Produce json
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339), не включая его"
+// @Param limit query int false "Сколько эндпоинтов вернуть" default(50)
+// @Success 200 {object} fiber.Map
+// @Failure 400 {object} apierror.Problem "bad_request"
+// @Router /admin/request-logs/error-rates [get]
+func GetErrorRates(c *fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	query, from, to, err := filterRequestLogs(c, true)
+	if err != nil {
+		return err
+	}
+
+	var stats []endpointErrors
+	err = query.
+		Select("method, COALESCE(NULLIF(route, ''), endpoint) AS endpoint, COUNT(*) AS requests, " +
+			"SUM(CASE WHEN status_code >= 400 AND status_code < 500 THEN 1 ELSE 0 END) AS client_errors, " +
+			"SUM(CASE WHEN status_code >= 500 THEN 1 ELSE 0 END) AS server_errors").
+		Group("method, COALESCE(NULLIF(route, ''), endpoint)").
+		Order("server_errors DESC, requests DESC").
+		Limit(limit).
+		Scan(&stats).Error
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+	if stats == nil {
+		stats = []endpointErrors{}
+	}
+	for i := range stats {
+		stats[i].ErrorRate = float64(stats[i].ServerErrors) / float64(stats[i].Requests)
+	}
+
+	return c.JSON(fiber.Map{"from": from, "to": to, "endpoints": stats})
+}
+
+// latencyBucket - перцентили времени обработки за интервал
+type latencyBucket struct {
+	Start time.Time `json:"start"`
+	// Requests - сколько записей интервала попало в расчёт (при выборке - только выбранные)
+	Requests int     `json:"requests"`
+	P50      float64 `json:"p50_ms"`
+	P95      float64 `json:"p95_ms"`
+}
+
+// GetLatency godoc
+// @Summary Время обработки запросов
+// @Description Возвращает p50 и p95 времени обработки в миллисекундах по интервалам за период (по умолчанию - последние сутки по часам, не больше 7 дней). Если записей за период больше 100000, перцентили считаются по равномерной выборке, а sample_rate показывает её долю. Принимает те же фильтры, что и /admin/request-logs. Требует права admin.
+// @Tags Admin
+// @Produce json
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339), не включая его"
+// @Param interval query string false "Длина интервала, например 15m или 1h" default(1h)
+// @Success 200 {object} fiber.Map
+// @Failure 400 {object} apierror.Problem "bad_request"
+// @Router /admin/request-logs/latency [get]
+func GetLatency(c *fiber.Ctx) error {
+	interval, err := time.ParseDuration(c.Query("interval", "1h"))
+	if err != nil || interval < time.Minute {
+		return apierror.BadRequest(apierror.CodeBadRequest, "requestlogs.invalid_param", "interval")
+	}
+
+	query, from, to, err := filterRequestLogs(c, true)
+	if err != nil {
+		return err
+	}
+	from = from.Truncate(interval)
+	if to.Sub(from) > maxLatencyPeriod {
+		return apierror.BadRequest(apierror.CodeBadRequest, "requestlogs.period_too_long", int(maxLatencyPeriod.Hours()/24))
+	}
+	if to.Sub(from)/interval >= maxLatencyBuckets {
+		return apierror.BadRequest(apierror.CodeBadRequest, "requestlogs.too_many_buckets", maxLatencyBuckets)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+	// Каждая step-я запись по id: выборка равномерна по периоду и не больше maxLatencySamples строк
+	step := (total + maxLatencySamples - 1) / maxLatencySamples
+	if step > 1 {
+		query = query.Where("id % ? = 0", step)
+	}
+
+	// MySQL не умеет считать перцентили, поэтому читаем время обработки построчно и считаем здесь
+	rows, err := query.Select("created_at, latency_ms").Limit(maxLatencySamples).Rows()
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+	defer rows.Close()
+
+	latencies := make(map[int][]float64)
+	for rows.Next() {
+		var (
+			createdAt time.Time
+			latency   float64
+		)
+		if err := rows.Scan(&createdAt, &latency); err != nil {
+			return apierror.Internal(apierror.CodeInternal, err)
+		}
+		index := int(createdAt.Sub(from) / interval)
+		latencies[index] = append(latencies[index], latency)
+	}
+	if err := rows.Err(); err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	buckets := make([]latencyBucket, 0, len(latencies))
+	for index, values := range latencies {
+		sort.Float64s(values)
+		buckets = append(buckets, latencyBucket{
+			Start:    from.Add(time.Duration(index) * interval),
+			Requests: len(values),
+			P50:      percentile(values, 0.50),
+			P95:      percentile(values, 0.95),
+		})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+
+	sampleRate := 1.0
+	if step > 1 {
+		sampleRate = 1 / float64(step)
+	}
+	return c.JSON(fiber.Map{"from": from, "to": to, "interval_seconds": int(interval.Seconds()), "sample_rate": sampleRate, "buckets": buckets})
+}
+
+// percentile - перцентиль отсортированной выборки по методу ближайшего ранга
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// filterRequestLogs применяет к выборке из request_logs фильтры запроса. Для агрегатов (lastDay)
+// период по умолчанию - последние сутки, чтобы случайно не пересчитывать весь журнал.
+func filterRequestLogs(c *fiber.Ctx, lastDay bool) (*gorm.DB, time.Time, time.Time, error) {
+	var from, to time.Time
+	if lastDay {
+		to = time.Now()
+		from = to.Add(-24 * time.Hour)
+	}
+	for param, moment := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, from, to, apierror.BadRequest(apierror.CodeBadRequest, "requestlogs.invalid_time", param)
+		}
+		*moment = parsed
+	}
+
+	query := db(c).Model(&models.RequestLog{})
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at < ?", to)
+	}
+
+	if endpoint := c.Query("endpoint"); endpoint != "" {
+		if prefix, ok := strings.CutSuffix(endpoint, "*"); ok {
+			query = query.Where("endpoint LIKE ? ESCAPE '!'", escapeLike(prefix)+"%")
+		} else {
+			query = query.Where("endpoint = ?", endpoint)
+		}
+	}
+	if route := c.Query("route"); route != "" {
+		query = query.Where("route = ?", route)
+	}
+	if method := c.Query("method"); method != "" {
+		query = query.Where("method = ?", strings.ToUpper(method))
+	}
+	for _, column := range []string{"ip", "geo"} {
+		if value := c.Query(column); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if value := c.Query("api_key_id"); value != "" {
+		keyID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, from, to, apierror.BadRequest(apierror.CodeBadRequest, "requestlogs.invalid_param", "api_key_id")
+		}
+		query = query.Where("api_key_id = ?", keyID)
+	}
+
+	if status := strings.ToLower(c.Query("status")); status != "" {
+		if class, ok := strings.CutSuffix(status, "xx"); ok && len(class) == 1 && class >= "1" && class <= "5" {
+			low, _ := strconv.Atoi(class)
+			query = query.Where("status_code >= ? AND status_code < ?", low*100, (low+1)*100)
+		} else if code, err := strconv.Atoi(status); err == nil && code >= 100 && code <= 599 {
+			query = query.Where("status_code = ?", code)
+		} else {
+			return nil, from, to, apierror.BadRequest(apierror.CodeBadRequest, "requestlogs.invalid_param", "status")
+		}
+	}
+
+	return query, from, to, nil
+}
+
+// escapeLike экранирует спецсимволы LIKE, чтобы _ и % в пути искались буквально.
+// Символ экранирования - !, потому что обратную косую черту MySQL и SQLite понимают по-разному.
+func escapeLike(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"geo_offers/apierror"
+	"geo_offers/i18n"
+	"geo_offers/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// TriggerSync godoc
+// @Summary Запуск синхронизации офферов
+// @Description Запускает синхронизацию офферов с CityAds в фоне. Кто запустил прогон, пишется в журнал аудита, изменения офферов - под run_id. Требует право sync:run.
+// @Tags Sync
+// @Produce json
+// @Success 200 {object} fiber.Map
+// @Failure 401 {object} apierror.Problem "invalid_token"
+// @Failure 403 {object} apierror.Problem "insufficient_scope"
+// @Router /sync-offers [post]
+func TriggerSync(c *fiber.Ctx) error {
+	runID := services.NewSyncRunID()
+
+	_, err := services.RecordAudit(db(c), auditActor(c), services.AuditSyncTrigger, 0, nil, map[string]any{"run_id": runID})
+	if err != nil {
+		return apierror.Internal(apierror.CodeInternal, err)
+	}
+
+	go services.RunSync(runID)
+
+	return c.JSON(fiber.Map{
+		"message": i18n.T(i18n.Lang(c), "sync.started"),
+		"run_id":  runID,
+	})
+}
@@ -0,0 +1,168 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Default - язык по умолчанию, если клиент не прислал поддерживаемый язык
+const Default = "ru"
+
+// LocalsKey - ключ в c.Locals, под которым middleware сохраняет язык запроса
+const LocalsKey = "lang"
+
+//go:embed locales/*.json
+var embedded embed.FS
+
+var (
+	mu       sync.RWMutex
+	catalogs = map[string]map[string]string{}
+)
+
+func init() {
+	entries, err := embedded.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := embedded.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		if err := merge(entry.Name(), data); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// LoadDir подгружает каталоги сообщений <lang>.json из директории.
+// Значения из файлов перекрывают встроенные, новые языки добавляются в список поддерживаемых.
+func LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := merge(filepath.Base(file), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge добавляет сообщения из файла <lang>.json в каталог языка
+func merge(fileName string, data []byte) error {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("каталог %s: %w", fileName, err)
+	}
+
+	lang := strings.ToLower(strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if catalogs[lang] == nil {
+		catalogs[lang] = map[string]string{}
+	}
+	for key, msg := range messages {
+		catalogs[lang][key] = msg
+	}
+	return nil
+}
+
+// Supported возвращает отсортированный список поддерживаемых языков
+func Supported() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+func isSupported(lang string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// T возвращает сообщение по ключу на нужном языке.
+// Если перевода нет, берётся язык по умолчанию, а если нет и его - сам ключ.
+func T(lang, key string, args ...any) string {
+	mu.RLock()
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		msg, ok = catalogs[Default][key]
+	}
+	mu.RUnlock()
+
+	if !ok {
+		msg = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Negotiate выбирает поддерживаемый язык по заголовку Accept-Language с учётом q-весов
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		// en-US -> en
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if q > bestQ && isSupported(lang) {
+			best, bestQ = lang, q
+		}
+	}
+	if best == "" {
+		return Default
+	}
+	return best
+}
+
+// Resolve определяет язык запроса: параметр lang важнее заголовка Accept-Language
+func Resolve(c *fiber.Ctx) string {
+	if lang := strings.ToLower(c.Query("lang")); lang != "" && isSupported(lang) {
+		return lang
+	}
+	return Negotiate(c.Get(fiber.HeaderAcceptLanguage))
+}
+
+// Lang возвращает язык текущего запроса (сохранённый middleware или вычисленный на месте)
+func Lang(c *fiber.Ctx) string {
+	if lang, ok := c.Locals(LocalsKey).(string); ok {
+		return lang
+	}
+	return Resolve(c)
+}
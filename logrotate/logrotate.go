@@ -0,0 +1,304 @@
+package logrotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat - метка времени в имени архивного файла: app-2006-01-02T15-04-05.000.log
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Options - правила ротации и хранения
+type Options struct {
+	// MaxSize - размер файла в байтах, после которого он ротируется (0 - без ограничения)
+	MaxSize int64
+	// Interval - ротация по времени, например раз в сутки (0 - выключена)
+	Interval time.Duration
+	// Compress - сжимать архивные файлы gzip
+	Compress bool
+	// MaxBackups - сколько архивных файлов хранить (0 - без ограничения)
+	MaxBackups int
+	// MaxAge - сколько хранить архивные файлы (0 - без ограничения)
+	MaxAge time.Duration
+}
+
+// File - файл лога с ротацией. Безопасен для записи из нескольких горутин.
+type File struct {
+	path    string
+	options Options
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// started - когда в файл начали писать, от этого считается ротация по времени
+	started time.Time
+
+	// millMu - сжатие и удаление старых файлов выполняются в фоне по одному
+	millMu sync.Mutex
+	// Now - источник времени, подменяется в тестах
+	Now func() time.Time
+}
+
+// Open открывает файл лога на дозапись
+func Open(path string, options Options) (*File, error) {
+	f := &File{path: path, options: options, Now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("ошибка создания директории для логов: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write пишет в файл, предварительно ротируя его, если он превысил размер или наступил новый интервал
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	now := f.Now()
+	if f.started.IsZero() {
+		f.started = now
+	}
+
+	overSize := f.options.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.options.MaxSize
+	overTime := f.options.Interval > 0 && !now.Before(f.started.Truncate(f.options.Interval).Add(f.options.Interval))
+	if overSize || overTime {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+		f.started = now
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Reopen закрывает и заново открывает файл по тому же пути.
+// Нужен для внешнего logrotate: он переименовывает файл и шлёт SIGHUP.
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+	}
+	return f.open()
+}
+
+// Rotate ротирует файл немедленно
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+// Close закрывает файл
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла логов: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	// Файл, начатый в прошлом интервале, ротируется при первой записи в новом.
+	// В пустой файл ещё не писали, для него время начала выставит первая запись.
+	f.started = time.Time{}
+	if f.size > 0 {
+		f.started = info.ModTime()
+	}
+	return nil
+}
+
+func (f *File) rotate() error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+
+	now := f.Now()
+	backupPath := f.backupName(now)
+	if err := os.Rename(f.path, backupPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	go f.mill(now)
+	return nil
+}
+
+// mill удаляет лишние архивные файлы и сжимает оставшиеся.
+// Логгер здесь использовать нельзя - он сам пишет в этот файл, поэтому ошибки идут в stderr.
+func (f *File) mill(now time.Time) {
+	f.millMu.Lock()
+	defer f.millMu.Unlock()
+
+	if err := f.cleanup(now); err != nil {
+		fmt.Fprintf(os.Stderr, "logrotate: ошибка удаления старых логов: %v\n", err)
+	}
+	if !f.options.Compress {
+		return
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logrotate: %v\n", err)
+		return
+	}
+	for _, b := range backups {
+		if strings.HasSuffix(b.path, ".gz") {
+			continue
+		}
+		if err := compress(b.path); err != nil {
+			fmt.Fprintf(os.Stderr, "logrotate: ошибка сжатия %s: %v\n", b.path, err)
+		}
+	}
+}
+
+// backupName - имя архивного файла: <имя>-<время><расширение>
+func (f *File) backupName(t time.Time) string {
+	dir, prefix, ext := f.parts()
+	return filepath.Join(dir, prefix+t.UTC().Format(backupTimeFormat)+ext)
+}
+
+func (f *File) parts() (dir, prefix, ext string) {
+	dir = filepath.Dir(f.path)
+	name := filepath.Base(f.path)
+	ext = filepath.Ext(name)
+	return dir, strings.TrimSuffix(name, ext) + "-", ext
+}
+
+type backup struct {
+	path string
+	time time.Time
+}
+
+// Backups возвращает архивные файлы, от новых к старым
+func (f *File) Backups() ([]string, error) {
+	backups, err := f.backups()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(backups))
+	for i, b := range backups {
+		paths[i] = b.path
+	}
+	return paths, nil
+}
+
+func (f *File) backups() ([]backup, error) {
+	dir, prefix, ext := f.parts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		stamp, ok := strings.CutSuffix(stamp, ext)
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, name), time: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.After(backups[j].time) })
+	return backups, nil
+}
+
+func (f *File) cleanup(now time.Time) error {
+	if f.options.MaxBackups <= 0 && f.options.MaxAge <= 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	cutoff := now.Add(-f.options.MaxAge)
+	for i, b := range backups {
+		tooMany := f.options.MaxBackups > 0 && i >= f.options.MaxBackups
+		tooOld := f.options.MaxAge > 0 && b.time.Before(cutoff)
+		if tooMany || tooOld {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
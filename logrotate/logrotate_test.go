@@ -0,0 +1,110 @@
+package logrotate_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"geo_offers/logrotate"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRotateBySize проверяет ротацию по размеру, сжатие архивов и удаление лишних.
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	file, err := logrotate.Open(path, logrotate.Options{MaxSize: 10, Compress: true, MaxBackups: 2})
+	assert.NoError(t, err)
+	defer file.Close()
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	file.Now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := file.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	// Четыре записи по 6-7 байт - три ротации, хранятся две последние
+	assert.Eventually(t, func() bool {
+		backups, _ := file.Backups()
+		return len(backups) == 2 && strings.HasSuffix(backups[0], ".gz") && strings.HasSuffix(backups[1], ".gz")
+	}, time.Second, 10*time.Millisecond)
+
+	current, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "fourth\n", string(current))
+
+	backups, err := file.Backups()
+	assert.NoError(t, err)
+	archive, err := os.Open(backups[0])
+	assert.NoError(t, err)
+	defer archive.Close()
+	reader, err := gzip.NewReader(archive)
+	assert.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "third\n", string(content))
+}
+
+// TestRotateByInterval проверяет ротацию по времени и удаление архивов по возрасту.
+func TestRotateByInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	file, err := logrotate.Open(path, logrotate.Options{Interval: 24 * time.Hour, MaxAge: 36 * time.Hour})
+	assert.NoError(t, err)
+	defer file.Close()
+	file.Now = clock
+
+	_, err = file.Write([]byte("day 1\n"))
+	assert.NoError(t, err)
+
+	// Новые сутки - новый файл
+	now = now.Add(24 * time.Hour)
+	_, err = file.Write([]byte("day 2\n"))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		backups, _ := file.Backups()
+		return len(backups) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Через двое суток первый архив старше MaxAge и удаляется
+	now = now.Add(48 * time.Hour)
+	_, err = file.Write([]byte("day 4\n"))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		backups, _ := file.Backups()
+		return len(backups) == 1 && strings.Contains(backups[0], "2026-01-04")
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestReopen проверяет работу с внешним logrotate: файл переименован, после Reopen пишется новый.
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	file, err := logrotate.Open(path, logrotate.Options{})
+	assert.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.Write([]byte("before\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Rename(path, filepath.Join(dir, "app.log.1")))
+	assert.NoError(t, file.Reopen())
+	_, err = file.Write([]byte("after\n"))
+	assert.NoError(t, err)
+
+	current, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "after\n", string(current))
+	moved, err := os.ReadFile(filepath.Join(dir, "app.log.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "before\n", string(moved))
+}
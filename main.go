@@ -1,60 +1,249 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"geo_offers/apierror"
+	"geo_offers/auth"
+	"geo_offers/clientip"
 	"geo_offers/config"
+	"geo_offers/geo"
 	"geo_offers/handlers"
+	"geo_offers/i18n"
+	"geo_offers/metrics"
 	"geo_offers/middleware"
 	"geo_offers/models"
+	"geo_offers/requestlog"
 	"geo_offers/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
 )
 
-// initEnv загружает переменные окружения из .env файла
+// initEnv загружает переменные окружения из .env файла и настраивает логгер
 func initEnv() {
-	if err := godotenv.Load(); err != nil {
-		fmt.Println("Не удалось загрузить .env файл. Используются переменные окружения по умолчанию.")
+	envErr := godotenv.Load()
+	config.SetupLogger()
+	if envErr != nil {
+		config.Log("main").Warn("Не удалось загрузить .env файл. Используются переменные окружения по умолчанию.")
+	}
+
+	// Переводы из I18N_DIR перекрывают встроенный каталог сообщений
+	if dir := os.Getenv("I18N_DIR"); dir != "" {
+		if err := i18n.LoadDir(dir); err != nil {
+			config.Fatal(config.Log("main"), "Ошибка загрузки каталога сообщений", "dir", dir, "error", err)
+		}
 	}
 }
 
-// initConnections настраивает логгер, подключается к базе данных, Redis и выполняет миграции
+// initConnections подключается к базе данных, Redis и выполняет миграции
 func initConnections() {
-	config.SetupLogger()
 	config.ConnectDB()
 	config.ConnectRedis()
+	config.ConnectGeoIP()
+	config.RegisterPoolMetrics()
+
+	// Приём JWT партнёрского портала включается, если задан JWKS
+	if err := auth.SetupJWT(); err != nil {
+		config.Fatal(config.Log("main"), "Ошибка загрузки JWKS", "error", err)
+	}
 
 	if err := config.DB.AutoMigrate(&models.Offer{}); err != nil {
-		log.Fatalf("Ошибка миграции: %v", err)
+		config.Fatal(config.Log("main"), "Ошибка миграции", "error", err)
+	}
+
+	// Названия стран на всех языках из встроенного справочника ISO 3166
+	if err := geo.SeedNames(config.DB); err != nil {
+		config.Fatal(config.Log("main"), "Ошибка заполнения справочника GEO", "error", err)
 	}
 }
 
 // setupRoutes регистрирует все маршруты API
-func setupRoutes(app *fiber.App) {
+func setupRoutes(app *fiber.App, logWriter *requestlog.Writer) {
 	// Middleware
-	app.Use(middleware.RateLimiter)
-	app.Use(middleware.RequestLogger)
-
-	// Роуты API
-	app.Get("/api/v1/offers/:geo", handlers.GetOffersByGeo)
-	app.Get("/api/v1/geo-stats", handlers.GetGeoStats)
-	app.Get("/api/v1/offers-sorted", handlers.GetAllOffersSortedByRating)
-	app.Get("/api/v1/metrics", middleware.MetricsHandler())
+	app.Use(middleware.RequestID)
+	app.Use(clientip.Middleware(clientIPResolver()))
+	app.Use(middleware.Language)
+	app.Use(middleware.MetricsMiddleware)
+	app.Use(middleware.RateLimiter(middleware.RateLimitConfigFromEnv()))
+	app.Use(middleware.RequestLogger(logWriter))
+
+	// Политики доступа задаются переменными AUTH_POLICY_*, формат описан в auth.ParsePolicies
+	readAuth := middleware.Authorize(middleware.PolicyFromEnv("AUTH_POLICY_READ", "public")...)
+	writeAuth := middleware.Authorize(middleware.PolicyFromEnv("AUTH_POLICY_WRITE", "scope:offers:write")...)
+	syncAuth := middleware.Authorize(middleware.PolicyFromEnv("AUTH_POLICY_SYNC", "scope:sync:run")...)
+	metricsAuth := middleware.Authorize(middleware.PolicyFromEnv("AUTH_POLICY_METRICS", "ip:127.0.0.1,::1 | scope:admin")...)
+	adminAuth := middleware.Authorize(middleware.PolicyFromEnv("AUTH_POLICY_ADMIN", "scope:admin")...)
+
+	// Роуты API (auto регистрируем раньше :geo)
+	app.Get("/api/v1/offers/auto", readAuth, handlers.GetOffersByIP)
+	app.Get("/api/v1/offers/:geo", readAuth, handlers.GetOffersByGeo)
+	app.Get("/api/v1/geo-stats", readAuth, handlers.GetGeoStats)
+	app.Get("/api/v1/offers-sorted", readAuth, handlers.GetAllOffersSortedByRating)
+	app.Get("/api/v1/rate-limit", handlers.GetRateLimit)
 	app.Get("/api/v1/health", handlers.HealthCheck)
 	app.Get("/api/v1/ping", handlers.Ping)
 
+	// С METRICS_PORT метрики отдаются только на отдельном порту (serveMetrics)
+	if os.Getenv("METRICS_PORT") == "" {
+		metricsGroup := app.Group("/api/v1/metrics", metricsAuth)
+		metricsGroup.Get("", middleware.MetricsHandler())
+	}
+
 	// Роут для запуска синхронизации офферов
-	app.Post("/sync-offers", func(c *fiber.Ctx) error {
-		go services.SyncOffers()
-		return c.JSON(fiber.Map{"message": "Синхронизация запущена"})
-	})
+	sync := app.Group("/sync-offers", syncAuth)
+	sync.Post("", handlers.TriggerSync)
+
+	// Роуты для изменения офферов и переопределения их названий на разных языках
+	offers := app.Group("/offers", writeAuth)
+	offers.Post("", handlers.CreateOffer)
+	offers.Patch("/:id", handlers.UpdateOffer)
+	offers.Delete("/:id", handlers.DeleteOffer)
+	offers.Put("/:id/names/:lang", handlers.SetOfferName)
+	offers.Delete("/:id/names/:lang", handlers.DeleteOfferName)
+
+	// Админка: выпуск, список и отзыв ключей API
+	admin := app.Group("/api/v1/admin", adminAuth)
+	admin.Post("/api-keys", handlers.CreateAPIKey)
+	admin.Get("/api-keys", handlers.ListAPIKeys)
+	admin.Delete("/api-keys/:id", handlers.RevokeAPIKey)
+
+	// Журнал запросов и аналитика по нему
+	admin.Get("/request-logs", handlers.GetRequestLogs)
+	admin.Get("/request-logs/top-geos", handlers.GetTopGeos)
+	admin.Get("/request-logs/error-rates", handlers.GetErrorRates)
+	admin.Get("/request-logs/latency", handlers.GetLatency)
+
+	// Журнал аудита изменений офферов
+	audit := app.Group("/api/v1/audit", adminAuth)
+	audit.Get("", handlers.GetAuditEvents)
+}
+
+// appConfig собирает настройки Fiber
+func appConfig() fiber.Config {
+	return fiber.Config{
+		// Все ошибки хендлеров и middleware отдаются в формате application/problem+json
+		ErrorHandler: apierror.Handler,
+	}
+}
+
+// shutdownTimeout - сколько ждать завершения запросов и записи журнала при остановке
+const shutdownTimeout = 10 * time.Second
+
+// requestLogWriter настраивает фоновую запись журнала запросов в БД:
+// REQUEST_LOG_QUEUE_SIZE, REQUEST_LOG_BATCH_SIZE, REQUEST_LOG_FLUSH_INTERVAL, REQUEST_LOG_DROP_POLICY
+func requestLogWriter() *requestlog.Writer {
+	options := requestlog.DefaultOptions()
+	if size, err := strconv.Atoi(os.Getenv("REQUEST_LOG_QUEUE_SIZE")); err == nil {
+		options.QueueSize = size
+	}
+	if size, err := strconv.Atoi(os.Getenv("REQUEST_LOG_BATCH_SIZE")); err == nil {
+		options.BatchSize = size
+	}
+	if interval, err := time.ParseDuration(os.Getenv("REQUEST_LOG_FLUSH_INTERVAL")); err == nil {
+		options.FlushInterval = interval
+	}
+	if policy := os.Getenv("REQUEST_LOG_DROP_POLICY"); policy != "" {
+		options.DropPolicy = policy
+	}
+	// REQUEST_LOG_REDACT - дополнительные параметры запроса, значения которых не сохраняются
+	options.SensitiveParams = append(options.SensitiveParams, splitEnv("REQUEST_LOG_REDACT")...)
+
+	writer, err := requestlog.NewWriter(config.DB, options)
+	if err != nil {
+		config.Fatal(config.Log("main"), "Ошибка в настройках журнала запросов", "error", err)
+	}
+	return writer
+}
+
+// requestLogPruner настраивает срок хранения журнала запросов: REQUEST_LOG_RETENTION_DAYS (0 - хранить всё),
+// REQUEST_LOG_PRUNE_INTERVAL, REQUEST_LOG_PRUNE_CHUNK, REQUEST_LOG_ROLLUP и REQUEST_LOG_PARTITIONS (только MySQL)
+func requestLogPruner() *requestlog.Pruner {
+	options := requestlog.DefaultRetentionOptions()
+	if days, err := strconv.Atoi(os.Getenv("REQUEST_LOG_RETENTION_DAYS")); err == nil {
+		options.Days = days
+	}
+	if interval, err := time.ParseDuration(os.Getenv("REQUEST_LOG_PRUNE_INTERVAL")); err == nil {
+		options.Interval = interval
+	}
+	if size, err := strconv.Atoi(os.Getenv("REQUEST_LOG_PRUNE_CHUNK")); err == nil {
+		options.ChunkSize = size
+	}
+	if rollup, err := strconv.ParseBool(os.Getenv("REQUEST_LOG_ROLLUP")); err == nil {
+		options.Rollup = rollup
+	}
+	if partitions, err := strconv.ParseBool(os.Getenv("REQUEST_LOG_PARTITIONS")); err == nil {
+		options.Partitions = partitions
+	}
+
+	pruner, err := requestlog.NewPruner(config.DB, options)
+	if err != nil {
+		config.Fatal(config.Log("main"), "Ошибка в настройках хранения журнала запросов", "error", err)
+	}
+	return pruner
+}
+
+// serveMetrics отдаёт метрики по пути /metrics на отдельном порту METRICS_PORT, пока не отменён ctx.
+// Порт рассчитан на внутреннюю сеть: политика AUTH_POLICY_METRICS на нём не проверяется.
+func serveMetrics(ctx context.Context, port string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{Addr: ":" + port, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			config.Log("main").Error("Ошибка остановки сервера метрик", "error", err)
+		}
+	}()
+
+	config.Log("main").Info("Метрики отдаются на отдельном порту", "port", port)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		config.Fatal(config.Log("main"), "Ошибка запуска сервера метрик", "error", err)
+	}
+}
+
+// clientIPResolver настраивает определение IP клиента за балансировщиком.
+// Заголовки прокси (CLIENT_IP_HEADERS, по умолчанию Forwarded, X-Forwarded-For, X-Real-IP)
+// читаются, только если запрос пришёл с адреса из TRUSTED_PROXIES.
+func clientIPResolver() *clientip.Resolver {
+	trusted, err := auth.ParseNets(splitEnv("TRUSTED_PROXIES"))
+	if err != nil {
+		config.Fatal(config.Log("main"), "Ошибка в TRUSTED_PROXIES", "error", err)
+	}
+
+	// PROXY_HEADER - прежнее название настройки, задавало один заголовок
+	headers := splitEnv("CLIENT_IP_HEADERS")
+	if len(headers) == 0 {
+		headers = splitEnv("PROXY_HEADER")
+	}
+
+	resolver, err := clientip.New(trusted, headers)
+	if err != nil {
+		config.Fatal(config.Log("main"), "Ошибка в CLIENT_IP_HEADERS", "error", err)
+	}
+	return resolver
+}
 
-	// Роут для создания оффера
-	app.Post("/offers", handlers.CreateOffer)
+// splitEnv читает из переменной окружения список через запятую
+func splitEnv(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
 }
 
 // @title Geo Offers API
@@ -69,13 +258,37 @@ func main() {
 	// Запуск фоновой синхронизации офферов
 	go services.SyncOffers()
 
-	app := fiber.New()
-	setupRoutes(app)
+	logWriter := requestLogWriter()
+	app := fiber.New(appConfig())
+	setupRoutes(app, logWriter)
+
+	// По SIGINT/SIGTERM перестаём принимать запросы, дожидаемся текущих и дописываем журнал запросов
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go requestLogPruner().Run(ctx)
+	if port := os.Getenv("METRICS_PORT"); port != "" {
+		go serveMetrics(ctx, port)
+	}
+	go func() {
+		<-ctx.Done()
+		config.Log("main").Info("Остановка API...")
+		if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			config.Log("main").Error("Ошибка остановки сервера", "error", err)
+		}
+	}()
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3000"
 	}
-	fmt.Printf("API запущено на порту %s\n", port)
-	log.Fatal(app.Listen(":" + port))
+	config.Log("main").Info("API запущено", "port", port)
+	if err := app.Listen(":" + port); err != nil {
+		config.Fatal(config.Log("main"), "Ошибка запуска сервера", "error", err)
+	}
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := logWriter.Close(drainCtx); err != nil {
+		config.Log("main").Error("Ошибка остановки журнала запросов", "error", err)
+	}
 }
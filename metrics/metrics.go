@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry - реестр метрик приложения. Пакеты регистрируют в нём свои метрики в init.
+// Отдаётся только он, поэтому в выдачу не попадает то, что библиотеки регистрируют в prometheus.DefaultRegisterer.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler отдаёт метрики Registry. Формат выбирается по Accept: текстовый формат Prometheus
+// или OpenMetrics (application/openmetrics-text), ответ сжимается gzip, если клиент его принимает.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(Registry, promhttp.HandlerFor(Registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+		// Ошибка одного коллектора не должна лишать Prometheus остальных метрик
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+}
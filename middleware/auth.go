@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"errors"
+	"os"
+
+	"geo_offers/apierror"
+	"geo_offers/auth"
+	"geo_offers/clientip"
+	"geo_offers/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Authorize пропускает запрос, если выполнена хотя бы одна из политик.
+// Ключ API или JWT берётся из заголовка Authorization (схема Bearer),
+// либо запрос подписывается HMAC секретом ключа (заголовки X-Signature-*).
+func Authorize(policies ...auth.Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var denied error
+		for _, policy := range policies {
+			err := checkPolicy(c, policy)
+			if err == nil {
+				return c.Next()
+			}
+			// Ошибку ключа показываем охотнее, чем отказ по IP: она подсказывает клиенту, что исправить
+			if denied == nil || policy.Kind != auth.PolicyIP {
+				denied = err
+			}
+		}
+		return denied
+	}
+}
+
+// RequireScopes - сокращение для Authorize(auth.Scoped(scopes...))
+func RequireScopes(scopes ...string) fiber.Handler {
+	return Authorize(auth.Scoped(scopes...))
+}
+
+// PolicyFromEnv читает политики доступа из переменной окружения, если она не задана - берёт значение по умолчанию
+func PolicyFromEnv(name, fallback string) []auth.Policy {
+	value := os.Getenv(name)
+	if value == "" {
+		value = fallback
+	}
+
+	policies, err := auth.ParsePolicies(value)
+	if err != nil {
+		config.Fatal(config.Log("middleware"), "Ошибка в политике доступа", "variable", name, "error", err)
+	}
+	return policies
+}
+
+func checkPolicy(c *fiber.Ctx, policy auth.Policy) error {
+	switch policy.Kind {
+	case auth.PolicyPublic:
+		return nil
+	case auth.PolicyIP:
+		if policy.AllowsIP(clientip.FromCtx(c)) {
+			return nil
+		}
+		return apierror.Forbidden(apierror.CodeForbidden, "auth.ip_not_allowed", clientip.FromCtx(c))
+	}
+
+	principal, err := authenticate(c)
+	if err != nil {
+		return err
+	}
+	for _, scope := range policy.Scopes {
+		if !principal.HasScope(scope) {
+			return apierror.Forbidden(apierror.CodeInsufficientScope, "auth.insufficient_scope", scope)
+		}
+	}
+	return nil
+}
+
+// authErrorKey - ключ в c.Locals для ошибки аутентификации: ключ проверяется один раз за запрос,
+// иначе повторная проверка подписанного запроса увидела бы уже использованный nonce
+const authErrorKey = "auth_error"
+
+// authenticate проверяет ключ API (результат кешируется в Locals на время запроса)
+func authenticate(c *fiber.Ctx) (*auth.Principal, error) {
+	if principal := auth.FromCtx(c); principal != nil {
+		return principal, nil
+	}
+	if err, ok := c.Locals(authErrorKey).(error); ok {
+		return nil, err
+	}
+
+	principal, err := authenticateRequest(c)
+	if err != nil {
+		c.Locals(authErrorKey, err)
+		return nil, err
+	}
+	c.Locals(auth.LocalsKey, principal)
+	return principal, nil
+}
+
+func authenticateRequest(c *fiber.Ctx) (*auth.Principal, error) {
+	var (
+		principal *auth.Principal
+		err       error
+	)
+	if c.Get(auth.HeaderSignature) != "" {
+		// Подписанный запрос от сервера партнёра: вместо ключа в заголовке - HMAC от запроса
+		principal, err = auth.AuthenticateSignature(c.UserContext(), auth.SignedRequest{
+			KeyID:     c.Get(auth.HeaderSignatureKey),
+			Timestamp: c.Get(auth.HeaderSignatureTimestamp),
+			Nonce:     c.Get(auth.HeaderSignatureNonce),
+			Signature: c.Get(auth.HeaderSignature),
+			Method:    c.Method(),
+			Path:      c.OriginalURL(),
+			Body:      c.Body(),
+		})
+	} else {
+		token := auth.BearerToken(c.Get(fiber.HeaderAuthorization))
+		if token == "" {
+			return nil, apierror.Unauthorized(apierror.CodeUnauthorized, "auth.missing_credentials")
+		}
+		principal, err = auth.Authenticate(c.UserContext(), token)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrInvalidSignature):
+		return nil, apierror.Unauthorized(apierror.CodeInvalidSignature, "auth.invalid_signature")
+	case errors.Is(err, auth.ErrStaleSignature):
+		return nil, apierror.Unauthorized(apierror.CodeInvalidSignature, "auth.stale_signature")
+	case errors.Is(err, auth.ErrReplayedSignature):
+		return nil, apierror.Unauthorized(apierror.CodeInvalidSignature, "auth.replayed_signature")
+	case errors.Is(err, auth.ErrRevokedKey):
+		return nil, apierror.Unauthorized(apierror.CodeInvalidToken, "auth.key_revoked")
+	case errors.Is(err, auth.ErrExpiredKey):
+		return nil, apierror.Unauthorized(apierror.CodeInvalidToken, "auth.key_expired")
+	case errors.Is(err, auth.ErrInvalidJWT):
+		return nil, apierror.Unauthorized(apierror.CodeInvalidToken, "auth.invalid_jwt")
+	case errors.Is(err, auth.ErrInvalidKey):
+		return nil, apierror.Unauthorized(apierror.CodeInvalidToken, "auth.invalid_token")
+	case err != nil:
+		return nil, apierror.Internal(apierror.CodeInternal, err)
+	}
+	return principal, nil
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"geo_offers/i18n"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Language определяет язык ответа по параметру lang или заголовку Accept-Language
+func Language(c *fiber.Ctx) error {
+	lang := i18n.Resolve(c)
+	c.Locals(i18n.LocalsKey, lang)
+
+	c.Set(fiber.HeaderContentLanguage, lang)
+	c.Vary(fiber.HeaderAcceptLanguage)
+
+	return c.Next()
+}
@@ -1,28 +1,63 @@
 package middleware
 
 import (
+	"strings"
+	"time"
+
+	"geo_offers/auth"
+	"geo_offers/clientip"
 	"geo_offers/config"
 	"geo_offers/models"
+	"geo_offers/requestlog"
 	"github.com/gofiber/fiber/v2"
 )
 
-// RequestLogger middleware записывает информацию о запросе в БД и в лог-файл.
-func RequestLogger(c *fiber.Ctx) error {
-	err := c.Next()
+// RequestLogger middleware записывает информацию о запросе в лог-файл и ставит её в очередь на запись в БД.
+func RequestLogger(writer *requestlog.Writer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		// Ошибку отдаём в ErrorHandler сразу, иначе в лог попадёт статус ещё не сформированного ответа
+		if err := c.Next(); err != nil {
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
 
-	logEntry := models.RequestLog{
-		Method:     c.Method(),
-		Endpoint:   c.Path(),
-		IP:         c.IP(),
-		UserAgent:  c.Get("User-Agent"),
-		StatusCode: c.Response().StatusCode(),
-	}
+		// Запись сохраняется после ответа, а строки Fiber ссылаются на буферы запроса, поэтому копируем их
+		logEntry := models.RequestLog{
+			Method:        strings.Clone(c.Method()),
+			Endpoint:      truncate(c.Path(), 255),
+			Route:         routeTemplate(c),
+			Query:         truncate(writer.RedactQuery(string(c.Request().URI().QueryString())), 2048),
+			IP:            clientip.FromCtx(c),
+			UserAgent:     truncate(c.Get(fiber.HeaderUserAgent), 512),
+			StatusCode:    c.Response().StatusCode(),
+			LatencyMs:     float64(time.Since(start).Microseconds()) / 1000,
+			RequestBytes:  len(c.Request().Body()),
+			ResponseBytes: len(c.Response().Body()),
+			RequestID:     config.RequestIDFrom(c.UserContext()),
+		}
+		if principal := auth.FromCtx(c); principal != nil && principal.KeyID != 0 {
+			keyID := principal.KeyID
+			logEntry.APIKeyID = &keyID
+		}
+		if geo, ok := c.Locals(requestlog.GeoKey).(string); ok {
+			logEntry.Geo = geo
+		}
+		logEntry.CacheHit, _ = c.Locals(requestlog.CacheHitKey).(bool)
+		writer.Enqueue(logEntry)
 
-	if result := config.DB.Create(&logEntry); result.Error != nil {
-		config.Logger.Printf("❌ Ошибка сохранения запроса в БД: %v", result.Error)
-	}
+		config.Log("middleware").InfoContext(c.UserContext(), "Request",
+			"method", logEntry.Method, "path", logEntry.Endpoint, "ip", logEntry.IP, "status", logEntry.StatusCode, "latency_ms", logEntry.LatencyMs)
 
-	config.Logger.Printf("Request: %s %s from %s - %d", c.Method(), c.Path(), c.IP(), c.Response().StatusCode())
+		return nil
+	}
+}
 
-	return err
+// truncate обрезает строку до размера колонки и копирует её: строки Fiber ссылаются на буферы запроса
+func truncate(value string, size int) string {
+	if len(value) > size {
+		value = strings.ToValidUTF8(value[:size], "")
+	}
+	return strings.Clone(value)
 }
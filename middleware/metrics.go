@@ -1,21 +1,29 @@
 package middleware
 
 import (
-	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"geo_offers/metrics"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// Здесь мы пишем метрики (в данном случае простая метрика)
+// unmatchedRoute - метка маршрута для запросов, которые не подходят ни к одному маршруту (404, 405)
+const unmatchedRoute = "unmatched"
+
+// Здесь мы пишем метрики. Маршрут в метках - шаблон из роутера (/api/v1/offers/:geo), а не путь запроса,
+// иначе каждый GEO и ID оффера давал бы свой временной ряд.
 var (
 	requestCount = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_requests_total",
 			Help: "Общее количество HTTP-запросов",
 		},
-		[]string{"method", "endpoint"},
+		[]string{"method", "route", "status"},
 	)
 
 	responseTime = prometheus.NewHistogramVec(
@@ -24,44 +32,91 @@ var (
 			Help:    "Время обработки HTTP-запросов",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"method", "endpoint"},
+		[]string{"method", "route"},
+	)
+
+	responseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "Размер тела HTTP-ответов",
+			Buckets: prometheus.ExponentialBuckets(100, 10, 6),
+		},
+		[]string{"method", "route"},
+	)
+
+	requestsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP-запросы, которые обрабатываются сейчас",
+		},
 	)
 )
 
 func init() {
-	prometheus.MustRegister(requestCount, responseTime)
+	metrics.Registry.MustRegister(requestCount, responseTime, responseSize, requestsInFlight)
 }
 
+// MetricsMiddleware считает запросы, время обработки и размер ответов по маршрутам и кодам ответа.
+// Подключается до RateLimiter, чтобы в метрики попадали и отклонённые запросы.
 func MetricsMiddleware(c *fiber.Ctx) error {
-	timer := prometheus.NewTimer(responseTime.WithLabelValues(c.Method(), c.Path()))
-	defer timer.ObserveDuration()
+	requestsInFlight.Inc()
+	defer requestsInFlight.Dec()
 
-	requestCount.WithLabelValues(c.Method(), c.Path()).Inc()
-	return c.Next()
-}
+	start := time.Now()
+	// Ошибку отдаём в ErrorHandler сразу, иначе код ответа ещё не известен
+	if err := c.Next(); err != nil {
+		if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+			_ = c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
 
-type customResponseWriter struct {
-	c *fiber.Ctx
+	method := strings.Clone(c.Method())
+	route := routeTemplate(c)
+	requestCount.WithLabelValues(method, route, strconv.Itoa(c.Response().StatusCode())).Inc()
+	responseTime.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	responseSize.WithLabelValues(method, route).Observe(float64(len(c.Response().Body())))
+	return nil
 }
 
-func (w *customResponseWriter) Header() http.Header {
-	return http.Header{}
+// routeTable - маршруты приложения без middleware: множество "METHOD шаблон" и шаблоны по методам в порядке регистрации
+type routeTable struct {
+	registered map[string]bool
+	byMethod   map[string][]string
 }
 
-func (w *customResponseWriter) Write(data []byte) (int, error) {
-	return w.c.Write(data)
-}
+// appRoutes - таблицы маршрутов приложений, собираются при первом запросе
+var appRoutes sync.Map
+
+// routeTemplate возвращает шаблон маршрута запроса.
+// Если запрос дошёл до обработчика, c.Route() и есть его маршрут. Если ответ отдал middleware раньше
+// (401 от проверки ключа в группе, 429 от лимитера), c.Route() указывает на этот middleware, поэтому
+// маршрут ищется по методу и пути среди зарегистрированных. Не нашёлся - запрос помечается как unmatched.
+func routeTemplate(c *fiber.Ctx) string {
+	table, ok := appRoutes.Load(c.App())
+	if !ok {
+		routes := routeTable{registered: make(map[string]bool), byMethod: make(map[string][]string)}
+		for _, route := range c.App().GetRoutes(true) {
+			routes.registered[route.Method+" "+route.Path] = true
+			routes.byMethod[route.Method] = append(routes.byMethod[route.Method], route.Path)
+		}
+		table, _ = appRoutes.LoadOrStore(c.App(), routes)
+	}
+	routes := table.(routeTable)
 
-func (w *customResponseWriter) WriteHeader(statusCode int) {
-	w.c.Status(statusCode)
+	if route := c.Route(); routes.registered[route.Method+" "+route.Path] {
+		return route.Path
+	}
+	path, config := c.Path(), c.App().Config()
+	for _, pattern := range routes.byMethod[c.Method()] {
+		if fiber.RoutePatternMatch(path, pattern, config) {
+			return pattern
+		}
+	}
+	return unmatchedRoute
 }
 
+// MetricsHandler отдаёт метрики из metrics.Registry через адаптер net/http: заголовки Accept и Accept-Encoding
+// доходят до promhttp, поэтому работают OpenMetrics и gzip
 func MetricsHandler() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		w := &customResponseWriter{c: c}
-		// Создаём "пустой" HTTP-запрос
-		dummyReq, _ := http.NewRequest("GET", "/metrics", nil)
-		promhttp.Handler().ServeHTTP(w, dummyReq)
-		return nil
-	}
+	return adaptor.HTTPHandler(metrics.Handler())
 }
@@ -1,32 +1,217 @@
 package middleware
 
 import (
-	"context"
-	"fmt"
+	"errors"
+	"os"
+	"strconv"
 	"time"
 
+	"geo_offers/apierror"
+	"geo_offers/auth"
+	"geo_offers/clientip"
 	"geo_offers/config"
+	"geo_offers/metrics"
+	"geo_offers/ratelimit"
 	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-// RateLimiter - ограничение запросов (100 запросов в минуту)
-func RateLimiter(c *fiber.Ctx) error {
-	ip := c.IP()
-	key := fmt.Sprintf("ratelimit:%s", ip)
+var rateLimitDecisions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ratelimit_decisions_total",
+		Help: "Решения лимитера по политикам (route:<name>, key:<id>, tier:<tier>, default, auth, exempt): allowed или blocked",
+	},
+	[]string{"policy", "result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(rateLimitDecisions)
+}
 
-	count, err := config.RedisClient.Incr(context.Background(), key).Result()
+// RateLimiter ограничивает запросы по политикам: лимит маршрута и лимит клиента
+// (персональный для ключа, по уровню anonymous/partner/internal или общий по IP).
+// Состояние самого строгого лимита отдаётся в заголовках RateLimit-* и X-RateLimit-*,
+// при отказе добавляется Retry-After.
+func RateLimiter(cfg ratelimit.Config) fiber.Handler {
+	primary, err := ratelimit.New(cfg.Algorithm, config.RedisClient)
+	if err != nil {
+		config.Fatal(config.Log("middleware"), "Ошибка в настройках ограничения запросов", "error", err)
+	}
+	// Пока Redis недоступен, лимиты считаются по режиму отказа, а не отдают 500 на каждый запрос
+	breaker := ratelimit.NewBreaker(cfg.Breaker.Failures, time.Duration(cfg.Breaker.Cooldown))
+	limiter, err := ratelimit.NewDegraded(primary, cfg.FailureMode, breaker, time.Duration(cfg.RedisTimeout))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сервера Redis"})
+		config.Fatal(config.Log("middleware"), "Ошибка в настройках ограничения запросов", "error", err)
+	}
+
+	return func(c *fiber.Ctx) error {
+		ip := clientip.FromCtx(c)
+		quota := &ratelimit.Quota{Tier: ratelimit.TierAnonymous, Subject: "ip:" + ip}
+		c.Locals(ratelimit.LocalsKey, quota)
+
+		if cfg.IsExempt(c.Method(), c.Path(), ip) {
+			quota.Tier, quota.Subject, _ = rateLimitSubject(c)
+			quota.Exempt = true
+			rateLimitDecisions.WithLabelValues("exempt", "allowed").Inc()
+			return c.Next()
+		}
+
+		// Проверка ключа стоит запроса к БД, поэтому перебор ключей с одного адреса отклоняется до неё
+		authLimit, guarded := cfg.AuthLimit(ip)
+		guarded = guarded && hasCredentials(c)
+		if guarded {
+			check := authLimit.Check()
+			check.Peek = true
+			results, err := limiter.AllowAll(c.UserContext(), []ratelimit.Check{check})
+			quota.Degraded = limiter.Active()
+			if err != nil {
+				return rateLimitError(err)
+			}
+			if !results[0].Allowed {
+				return rejectRequest(c, ratelimit.LimitStatus{Limit: authLimit, Result: results[0]})
+			}
+		}
+
+		tier, subject, failed := rateLimitSubject(c)
+		quota.Tier, quota.Subject = tier, subject
+
+		// Неудачная попытка учитывается, даже если запрос отклонят другие лимиты
+		if guarded && failed {
+			results, err := limiter.AllowAll(c.UserContext(), []ratelimit.Check{authLimit.Check()})
+			quota.Degraded = limiter.Active()
+			if err != nil {
+				return rateLimitError(err)
+			}
+			quota.Limits = append(quota.Limits, ratelimit.LimitStatus{Limit: authLimit, Result: results[0]})
+		}
+
+		limits := cfg.Limits(ratelimit.Request{Method: c.Method(), Path: c.Path(), Tier: tier, Subject: subject})
+
+		// Все лимиты проверяются разом: отказ по одному не расходует остальные
+		checks := make([]ratelimit.Check, len(limits))
+		for i, limit := range limits {
+			checks[i] = limit.Check()
+		}
+		if len(checks) > 0 {
+			results, err := limiter.AllowAll(c.UserContext(), checks)
+			quota.Degraded = limiter.Active()
+			if err != nil {
+				return rateLimitError(err)
+			}
+			for i, limit := range limits {
+				quota.Limits = append(quota.Limits, ratelimit.LimitStatus{Limit: limit, Result: results[i]})
+			}
+		}
+
+		for _, status := range quota.Limits {
+			if !status.Allowed {
+				return rejectRequest(c, status)
+			}
+		}
+		for _, status := range quota.Limits {
+			rateLimitDecisions.WithLabelValues(status.Name, "allowed").Inc()
+		}
+
+		if status, ok := quota.Tightest(); ok {
+			setRateLimitHeaders(c, status)
+		}
+		return c.Next()
+	}
+}
+
+// rejectRequest отклоняет запрос по исчерпанному лимиту
+func rejectRequest(c *fiber.Ctx, status ratelimit.LimitStatus) error {
+	rateLimitDecisions.WithLabelValues(status.Name, "blocked").Inc()
+	setRateLimitHeaders(c, status)
+	retryAfter := ceilSeconds(status.RetryAfter)
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return apierror.TooManyRequests(apierror.CodeRateLimited, "ratelimit.exceeded", retryAfter)
+}
+
+// rateLimitError превращает ошибку лимитера в ответ: 503, если Redis недоступен в режиме closed
+func rateLimitError(err error) error {
+	if errors.Is(err, ratelimit.ErrUnavailable) {
+		return apierror.New(fiber.StatusServiceUnavailable, apierror.CodeRedisUnavailable, "ratelimit.unavailable").Wrap(err)
 	}
+	return apierror.Internal(apierror.CodeRedisUnavailable, err)
+}
+
+// setRateLimitHeaders выставляет заголовки по черновику IETF (RateLimit-Reset - секунды до сброса)
+// и привычные X-RateLimit-* (X-RateLimit-Reset - unix-время сброса)
+func setRateLimitHeaders(c *fiber.Ctx, status ratelimit.LimitStatus) {
+	reset := ceilSeconds(status.ResetAfter)
+	c.Set("RateLimit-Limit", strconv.Itoa(status.Result.Limit))
+	c.Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	c.Set("RateLimit-Reset", strconv.Itoa(reset))
+	c.Set("X-RateLimit-Limit", strconv.Itoa(status.Result.Limit))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	c.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Duration(reset)*time.Second).Unix(), 10))
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// RateLimitConfigFromEnv читает политики из файла RATE_LIMIT_CONFIG.
+// Без файла действует общий лимит по IP из RATE_LIMIT, RATE_LIMIT_WINDOW и RATE_LIMIT_ALGORITHM.
+func RateLimitConfigFromEnv() ratelimit.Config {
+	if file := os.Getenv("RATE_LIMIT_CONFIG"); file != "" {
+		cfg, err := ratelimit.LoadConfig(file)
+		if err != nil {
+			config.Fatal(config.Log("middleware"), "Ошибка в RATE_LIMIT_CONFIG", "file", file, "error", err)
+		}
+		return cfg
+	}
+
+	cfg := ratelimit.DefaultConfig()
+	if algorithm := os.Getenv("RATE_LIMIT_ALGORITHM"); algorithm != "" {
+		cfg.Algorithm = algorithm
+	}
+	if mode := os.Getenv("RATE_LIMIT_FAILURE_MODE"); mode != "" {
+		cfg.FailureMode = mode
+	}
+	if limit, err := strconv.Atoi(os.Getenv("RATE_LIMIT")); err == nil && limit > 0 {
+		cfg.Default.Limit = limit
+	}
+	if window, err := time.ParseDuration(os.Getenv("RATE_LIMIT_WINDOW")); err == nil && window > 0 {
+		cfg.Default.Window = ratelimit.Duration(window)
+	}
+	if err := cfg.Prepare(); err != nil {
+		config.Fatal(config.Log("middleware"), "Ошибка в настройках ограничения запросов", "error", err)
+	}
+	return cfg
+}
+
+// hasCredentials сообщает, что запрос пришёл с ключом, подписью или токеном
+func hasCredentials(c *fiber.Ctx) bool {
+	return c.Get(fiber.HeaderAuthorization) != "" || c.Get(auth.HeaderSignature) != ""
+}
 
-	if count == 1 {
-		config.RedisClient.Expire(context.Background(), key, time.Minute)
+// rateLimitSubject определяет уровень клиента и то, по чему считаются его запросы.
+// Неверный ключ не отклоняет запрос здесь: это сделает Authorize, а до тех пор клиент считается анонимным.
+// failed сообщает, что ключ не прошёл проверку (ошибка БД попыткой подбора не считается).
+func rateLimitSubject(c *fiber.Ctx) (tier, subject string, failed bool) {
+	anonymous := "ip:" + clientip.FromCtx(c)
+	if !hasCredentials(c) {
+		return ratelimit.TierAnonymous, anonymous, false
 	}
 
-	// Если лимит превышен, блокируем, ставим лимит на 30 (можно и побольше)
-	if count > 30 {
-		return c.Status(429).JSON(fiber.Map{"error": "Слишком много запросов. Попробуйте позже."})
+	principal, err := authenticate(c)
+	if err != nil {
+		return ratelimit.TierAnonymous, anonymous, apierror.From(err).Status == fiber.StatusUnauthorized
 	}
 
-	return c.Next()
+	tier = ratelimit.TierPartner
+	if principal.Type == auth.PrincipalStaticToken || principal.HasScope(auth.ScopeAdmin) {
+		tier = ratelimit.TierInternal
+	}
+
+	switch {
+	case principal.KeyID != 0:
+		return tier, "key:" + strconv.FormatUint(uint64(principal.KeyID), 10), false
+	case principal.PartnerID != "":
+		return tier, "partner:" + principal.PartnerID, false
+	}
+	return tier, anonymous, false
 }
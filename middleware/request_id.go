@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"regexp"
+	"strings"
+
+	"geo_offers/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// requestIDPattern - какие X-Request-ID клиента принимаем. Остальные заменяем своим,
+// чтобы в логи и заголовки не попадали переводы строк и произвольно длинные значения.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID берёт X-Request-ID из запроса (от клиента или балансировщика) или создаёт новый UUID.
+// Идентификатор возвращается в заголовке ответа и кладётся в c.UserContext(): оттуда его берут
+// логи, тела ошибок, журнал запросов и вызовы БД и Redis. Подключается первым.
+func RequestID(c *fiber.Ctx) error {
+	requestID := c.Get(fiber.HeaderXRequestID)
+	if requestIDPattern.MatchString(requestID) {
+		requestID = strings.Clone(requestID)
+	} else {
+		requestID = uuid.NewString()
+	}
+
+	c.Set(fiber.HeaderXRequestID, requestID)
+	c.SetUserContext(config.WithRequestID(c.UserContext(), requestID))
+	return c.Next()
+}
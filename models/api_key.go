@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey - ключ доступа к API. Сам ключ не храним, только его SHA-256.
+type APIKey struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	Name    string `gorm:"size:100" json:"name"`
+	Prefix  string `gorm:"size:16;index" json:"prefix"`
+	KeyHash string `gorm:"size:64;uniqueIndex" json:"-"`
+	// Scopes - права ключа через пробел, например "offers:read offers:write"
+	Scopes string `gorm:"size:255" json:"-"`
+	// SigningSecret - секрет для HMAC-подписи запросов. Нужен в открытом виде, поэтому наружу не отдаётся.
+	SigningSecret string     `gorm:"size:64" json:"-"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	LastUsedAt    *time.Time `json:"last_used_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ScopeList возвращает права ключа списком
+func (k APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// Active - ключ не отозван и не истёк
+func (k APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
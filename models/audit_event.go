@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuditEvent - запись журнала изменений офферов: кто, что и как поменял
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	// ActorType - кто выполнил действие: api_key, signed_key, jwt, static_token или sync
+	ActorType string `gorm:"size:32;index:idx_audit_actor" json:"actor_type"`
+	// ActorID - ID ключа, партнёра или прогона синхронизации
+	ActorID   string `gorm:"size:64;index:idx_audit_actor" json:"actor_id"`
+	Action    string `gorm:"size:32;index" json:"action"`
+	OfferID   int    `gorm:"index" json:"offer_id"`
+	RequestID string `gorm:"size:64" json:"request_id"`
+	// Before, After и Changes - JSON: состояние до, после и изменённые поля {"поле": {"from": ..., "to": ...}}
+	Before  string `gorm:"type:text" json:"-"`
+	After   string `gorm:"type:text" json:"-"`
+	Changes string `gorm:"type:text" json:"-"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// GeoName - название GEO на конкретном языке
+type GeoName struct {
+	GeoCode string `gorm:"primaryKey;size:8" json:"geo_code"`
+	Lang    string `gorm:"primaryKey;size:8" json:"lang"`
+	Name    string `json:"name"`
+}
+
+// OfferName - переопределённое название оффера на конкретном языке
+type OfferName struct {
+	OfferID int    `gorm:"primaryKey;autoIncrement:false" json:"offer_id"`
+	Lang    string `gorm:"primaryKey;size:8" json:"lang"`
+	Name    string `json:"name"`
+}
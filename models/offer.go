@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Offer struct {
 	ExternalID   int     `gorm:"primaryKey" json:"external_id"`
 	Name         string  `json:"name"`
@@ -10,4 +12,6 @@ type Offer struct {
 	GeoCode      string  `json:"geo_code"`
 	GeoName      string  `json:"geo_name"`
 	Rating       float64 `json:"rating"`
+	// DeactivatedAt - когда оффер пропал из выдачи CityAds, nil у активных. Деактивированные офферы в выдачу не попадают
+	DeactivatedAt *time.Time `gorm:"index" json:"deactivated_at,omitempty"`
 }
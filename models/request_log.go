@@ -1,12 +1,31 @@
 package models
 
-import "gorm.io/gorm"
+import "time"
 
+// RequestLog - запись журнала запросов к API.
+// Индексы (поле, created_at) рассчитаны на выборки аналитиков за период по эндпоинту, статусу, ключу API и GEO.
 type RequestLog struct {
-	gorm.Model
-	Method     string `json:"method"`
-	Endpoint   string `json:"endpoint"`
-	IP         string `json:"ip"`
-	UserAgent  string `json:"user_agent"`
-	StatusCode int    `json:"status_code"`
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index;index:idx_request_logs_endpoint,priority:2;index:idx_request_logs_status,priority:2;index:idx_request_logs_api_key,priority:2;index:idx_request_logs_geo,priority:2" json:"created_at"`
+	Method    string    `gorm:"size:16" json:"method"`
+	Endpoint  string    `gorm:"size:255;index:idx_request_logs_endpoint,priority:1" json:"endpoint"`
+	// Route - шаблон маршрута из роутера (/api/v1/offers/:geo), unmatched для запросов мимо маршрутов
+	Route string `gorm:"size:255" json:"route"`
+	// Query - строка запроса, значения чувствительных параметров (ключи, токены, подписи) заменены на REDACTED
+	Query      string `gorm:"size:2048" json:"query"`
+	IP         string `gorm:"size:45;index" json:"ip"`
+	UserAgent  string `gorm:"size:512" json:"user_agent"`
+	StatusCode int    `gorm:"index:idx_request_logs_status,priority:1" json:"status_code"`
+	// LatencyMs - время обработки запроса в миллисекундах
+	LatencyMs     float64 `json:"latency_ms"`
+	RequestBytes  int     `json:"request_bytes"`
+	ResponseBytes int     `json:"response_bytes"`
+	// APIKeyID - ключ API, с которым пришёл запрос (ключом или подписью), nil для остальных
+	APIKeyID *uint `gorm:"index:idx_request_logs_api_key,priority:1" json:"api_key_id"`
+	// Geo - GEO или регион, для которого отдавались офферы
+	Geo string `gorm:"size:16;index:idx_request_logs_geo,priority:1" json:"geo,omitempty"`
+	// CacheHit - ответ отдан из кеша Redis
+	CacheHit bool `json:"cache_hit"`
+	// RequestID - X-Request-ID запроса, по нему запись находится в логах и в ответе клиенту
+	RequestID string `gorm:"size:128;index" json:"request_id"`
 }
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RequestLogDaily - дневной агрегат журнала запросов. В него сворачиваются записи request_logs
+// перед удалением по сроку хранения, так что статистика за прошлые периоды остаётся.
+// Записи группируются по шаблону маршрута, а не по пути, чтобы /offers/:id не давал строку на каждый ID.
+type RequestLogDaily struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	Day        time.Time `gorm:"type:date;uniqueIndex:idx_request_log_daily,priority:1" json:"day"`
+	Method     string    `gorm:"size:16;uniqueIndex:idx_request_log_daily,priority:2" json:"method"`
+	Route      string    `gorm:"size:255;uniqueIndex:idx_request_log_daily,priority:3" json:"route"`
+	StatusCode int       `gorm:"uniqueIndex:idx_request_log_daily,priority:4" json:"status_code"`
+	Geo        string    `gorm:"size:16;uniqueIndex:idx_request_log_daily,priority:5" json:"geo"`
+	// APIKeyID - ключ API, 0 для запросов без ключа
+	APIKeyID      uint    `gorm:"uniqueIndex:idx_request_log_daily,priority:6" json:"api_key_id"`
+	Requests      int64   `json:"requests"`
+	CacheHits     int64   `json:"cache_hits"`
+	LatencySumMs  float64 `json:"latency_sum_ms"`
+	LatencyMaxMs  float64 `json:"latency_max_ms"`
+	RequestBytes  int64   `json:"request_bytes"`
+	ResponseBytes int64   `json:"response_bytes"`
+}
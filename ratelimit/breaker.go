@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Состояния автомата защиты
+const (
+	// BreakerClosed - Redis работает, запросы идут в него
+	BreakerClosed = "closed"
+	// BreakerOpen - Redis считается недоступным, запросы в него не отправляются
+	BreakerOpen = "open"
+	// BreakerHalfOpen - пауза прошла, один пробный запрос проверяет, ожил ли Redis
+	BreakerHalfOpen = "half_open"
+)
+
+// Breaker - автомат защиты: после Failures ошибок подряд перестаёт обращаться к Redis на Cooldown,
+// чтобы каждый запрос к API не ждал таймаута мёртвого сервиса
+type Breaker struct {
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	Failures int
+	Cooldown time.Duration
+	// Now - источник времени, подменяется в тестах
+	Now func() time.Time
+	// OnStateChange вызывается при смене состояния
+	OnStateChange func(state string)
+}
+
+func NewBreaker(failures int, cooldown time.Duration) *Breaker {
+	return &Breaker{state: BreakerClosed, Failures: failures, Cooldown: cooldown, Now: time.Now}
+}
+
+// Allow сообщает, можно ли сейчас обращаться к Redis
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.Now().Sub(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		// Пока пробный запрос не вернулся, остальные идут мимо Redis
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success отмечает успешное обращение к Redis
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.setState(BreakerClosed)
+}
+
+// Failure отмечает ошибку Redis
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.failures >= b.Failures {
+		b.openedAt = b.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// State возвращает текущее состояние
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) setState(state string) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.OnStateChange != nil {
+		b.OnStateChange(state)
+	}
+}
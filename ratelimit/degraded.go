@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"geo_offers/config"
+	"geo_offers/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Что делать с запросами, пока Redis недоступен
+const (
+	// FailureModeMemory - считать лимиты в памяти экземпляра (по умолчанию)
+	FailureModeMemory = "memory"
+	// FailureModeOpen - пропускать все запросы без ограничений
+	FailureModeOpen = "open"
+	// FailureModeClosed - отклонять все запросы
+	FailureModeClosed = "closed"
+)
+
+// ErrUnavailable - Redis недоступен, а режим отказа closed
+var ErrUnavailable = errors.New("хранилище лимитов недоступно")
+
+var (
+	degradedGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ratelimit_degraded",
+			Help: "1, если ограничение запросов работает без Redis (автомат защиты разомкнут)",
+		},
+	)
+
+	backendErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ratelimit_backend_errors_total",
+			Help: "Ошибки Redis при проверке лимита",
+		},
+	)
+
+	degradedDecisions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ratelimit_degraded_decisions_total",
+			Help: "Решения лимитера без Redis по режиму отказа и результату",
+		},
+		[]string{"mode", "allowed"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(degradedGauge, backendErrors, degradedDecisions)
+}
+
+// Degraded - лимитер поверх Redis, который переживает недоступность Redis:
+// автомат защиты перестаёт обращаться к Redis после серии ошибок, а решение принимается по режиму отказа
+type Degraded struct {
+	primary Limiter
+	memory  *Memory
+	breaker *Breaker
+	mode    string
+	timeout time.Duration
+}
+
+// NewDegraded оборачивает лимитер. timeout ограничивает время ответа Redis на одну проверку.
+func NewDegraded(primary Limiter, mode string, breaker *Breaker, timeout time.Duration) (*Degraded, error) {
+	if err := validMode(mode); err != nil {
+		return nil, err
+	}
+	if mode == "" {
+		mode = FailureModeMemory
+	}
+
+	breaker.OnStateChange = func(state string) {
+		if state == BreakerClosed {
+			degradedGauge.Set(0)
+			config.Log("ratelimit").Info("Redis снова доступен, лимиты считаются в Redis")
+		} else {
+			degradedGauge.Set(1)
+			config.Log("ratelimit").Warn("Redis недоступен, лимиты считаются по режиму отказа", "mode", mode, "breaker", state)
+		}
+	}
+	return &Degraded{primary: primary, memory: NewMemory(), breaker: breaker, mode: mode, timeout: timeout}, nil
+}
+
+func (l *Degraded) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	return allowOne(ctx, l, key, limit, window)
+}
+
+func (l *Degraded) AllowAll(ctx context.Context, checks []Check) ([]Result, error) {
+	if l.breaker.Allow() {
+		if l.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, l.timeout)
+			defer cancel()
+		}
+
+		results, err := l.primary.AllowAll(ctx, checks)
+		if err == nil {
+			l.breaker.Success()
+			return results, nil
+		}
+		l.breaker.Failure()
+		backendErrors.Inc()
+	}
+
+	results, err := l.fallback(ctx, checks)
+	degradedDecisions.WithLabelValues(l.mode, fmt.Sprint(err == nil && Allowed(results))).Inc()
+	return results, err
+}
+
+// Active сообщает, что лимитер сейчас работает без Redis
+func (l *Degraded) Active() bool {
+	return l.breaker.State() != BreakerClosed
+}
+
+func (l *Degraded) fallback(ctx context.Context, checks []Check) ([]Result, error) {
+	switch l.mode {
+	case FailureModeOpen:
+		results := make([]Result, len(checks))
+		for i, check := range checks {
+			results[i] = Result{Allowed: true, Limit: check.Limit, Remaining: check.Limit}
+		}
+		return results, nil
+	case FailureModeClosed:
+		return nil, ErrUnavailable
+	}
+	return l.memory.AllowAll(ctx, checks)
+}
+
+func validMode(mode string) error {
+	switch mode {
+	case "", FailureModeMemory, FailureModeOpen, FailureModeClosed:
+		return nil
+	}
+	return fmt.Errorf("неизвестный режим отказа %q", mode)
+}
@@ -0,0 +1,86 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"geo_offers/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenLimiter имитирует недоступный Redis и считает обращения к нему
+type brokenLimiter struct {
+	calls int
+	fail  bool
+}
+
+func (l *brokenLimiter) AllowAll(_ context.Context, checks []ratelimit.Check) ([]ratelimit.Result, error) {
+	l.calls++
+	if l.fail {
+		return nil, errors.New("connection refused")
+	}
+	results := make([]ratelimit.Result, len(checks))
+	for i, check := range checks {
+		results[i] = ratelimit.Result{Allowed: true, Limit: check.Limit, Remaining: check.Limit - 1}
+	}
+	return results, nil
+}
+
+// TestDegradedMemory проверяет запасной лимитер в памяти и размыкание автомата защиты.
+func TestDegradedMemory(t *testing.T) {
+	primary := &brokenLimiter{fail: true}
+	now := time.Unix(1_700_000_000, 0)
+	breaker := ratelimit.NewBreaker(3, 10*time.Second)
+	breaker.Now = func() time.Time { return now }
+
+	limiter, err := ratelimit.NewDegraded(primary, ratelimit.FailureModeMemory, breaker, 0)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		result, err := limiter.Allow(ctx, "ip", 5, time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+	// Лимит соблюдается и без Redis
+	result, err := limiter.Allow(ctx, "ip", 5, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	// После трёх ошибок подряд Redis больше не опрашивается
+	assert.Equal(t, 3, primary.calls)
+	assert.True(t, limiter.Active())
+	assert.Equal(t, ratelimit.BreakerOpen, breaker.State())
+
+	// По истечении паузы пробный запрос проходит, и автомат замыкается
+	primary.fail = false
+	now = now.Add(10 * time.Second)
+	result, err = limiter.Allow(ctx, "ip", 5, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 4, primary.calls)
+	assert.False(t, limiter.Active())
+}
+
+// TestDegradedModes проверяет режимы open и closed.
+func TestDegradedModes(t *testing.T) {
+	ctx := context.Background()
+
+	open, err := ratelimit.NewDegraded(&brokenLimiter{fail: true}, ratelimit.FailureModeOpen, ratelimit.NewBreaker(1, time.Minute), 0)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		result, err := open.Allow(ctx, "ip", 1, time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+
+	closed, err := ratelimit.NewDegraded(&brokenLimiter{fail: true}, ratelimit.FailureModeClosed, ratelimit.NewBreaker(1, time.Minute), 0)
+	assert.NoError(t, err)
+	_, err = closed.Allow(ctx, "ip", 1, time.Minute)
+	assert.ErrorIs(t, err, ratelimit.ErrUnavailable)
+
+	_, err = ratelimit.NewDegraded(&brokenLimiter{}, "retry", ratelimit.NewBreaker(1, time.Minute), 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// memoryBucket - корзина токенов одного ключа
+type memoryBucket struct {
+	tokens float64
+	ts     time.Time
+	window time.Duration
+}
+
+// Memory - лимитер «корзина токенов» в памяти процесса. Используется как запасной, пока Redis недоступен:
+// лимиты считаются отдельно на каждом экземпляре API, зато не зависят от внешних сервисов.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	swept   time.Time
+	// Now - источник времени, подменяется в тестах
+	Now func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*memoryBucket{}, Now: time.Now}
+}
+
+func (l *Memory) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	return allowOne(ctx, l, key, limit, window)
+}
+
+func (l *Memory) AllowAll(_ context.Context, checks []Check) ([]Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	l.sweep(now)
+
+	// Сначала пополняем все корзины, и только если токен есть в каждой, списываем его
+	buckets := make([]*memoryBucket, len(checks))
+	allowed := true
+	for i, check := range checks {
+		capacity := float64(check.Limit)
+		bucket, ok := l.buckets[check.Key]
+		if !ok {
+			bucket = &memoryBucket{tokens: capacity, ts: now}
+			l.buckets[check.Key] = bucket
+		}
+		bucket.window = check.Window
+		bucket.tokens = math.Min(capacity, bucket.tokens+float64(now.Sub(bucket.ts))*capacity/float64(check.Window))
+		bucket.ts = now
+		buckets[i] = bucket
+		allowed = allowed && bucket.tokens >= 1
+	}
+
+	results := make([]Result, len(checks))
+	for i, check := range checks {
+		bucket := buckets[i]
+		capacity := float64(check.Limit)
+		rate := capacity / float64(check.Window)
+
+		result := Result{Limit: check.Limit, Allowed: bucket.tokens >= 1}
+		if !result.Allowed {
+			result.RetryAfter = time.Duration(math.Ceil((1 - bucket.tokens) / rate))
+		}
+		if allowed && !check.Peek {
+			bucket.tokens--
+		}
+		result.Remaining = int(bucket.tokens)
+		result.ResetAfter = time.Duration(math.Ceil((capacity - bucket.tokens) / rate))
+		results[i] = result
+	}
+	return results, nil
+}
+
+// sweep раз в минуту удаляет корзины, которые успели полностью восстановиться
+func (l *Memory) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.ts) >= bucket.window {
+			delete(l.buckets, key)
+		}
+	}
+}
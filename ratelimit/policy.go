@@ -0,0 +1,301 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"geo_offers/auth"
+)
+
+// Уровни клиентов, для каждого можно задать свой лимит
+const (
+	// TierAnonymous - запросы без ключа, считаются по IP
+	TierAnonymous = "anonymous"
+	// TierPartner - ключи API, подписанные запросы и JWT партнёров
+	TierPartner = "partner"
+	// TierInternal - API_TOKEN и ключи с правом admin
+	TierInternal = "internal"
+)
+
+// Duration - длительность в JSON в формате time.ParseDuration ("30s", "1m", "1h")
+type Duration time.Duration
+
+// UnmarshalJSON разбирает строку длительности
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("длительность должна быть строкой: %s", data)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Rule - лимит: не больше Limit запросов за Window. Limit 0 снимает ограничение.
+type Rule struct {
+	Limit  int      `json:"limit"`
+	Window Duration `json:"window"`
+}
+
+// RouteRule - лимит на маршрут. Pattern - "[METHOD ]/path", где * заменяет один сегмент пути,
+// а /* в конце - любой хвост (например, "POST /offers/*" или "/api/v1/offers/*").
+type RouteRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Rule
+}
+
+// Config - политики ограничения запросов.
+// На запрос действуют лимит маршрута (если маршрут описан в Routes) и лимит клиента:
+// персональный из Keys, иначе лимит его уровня из Tiers, иначе Default.
+type Config struct {
+	Algorithm string `json:"algorithm"`
+	Default   Rule   `json:"default"`
+	// Tiers - лимиты по уровням: anonymous, partner, internal
+	Tiers map[string]Rule `json:"tiers"`
+	// Keys - персональные лимиты: "key:<id ключа API>" или "partner:<partner_id из JWT>"
+	Keys   map[string]Rule `json:"keys"`
+	Routes []RouteRule     `json:"routes"`
+	// Auth - неудачные попытки аутентификации с одного адреса. Пока лимит исчерпан, запросы с ключом
+	// с этого адреса отклоняются до проверки ключа в БД.
+	Auth Rule `json:"auth"`
+	// Exempt - маршруты без ограничений (проверки здоровья, метрики)
+	Exempt []string `json:"exempt"`
+	// Allowlist - адреса и подсети, запросы с которых не ограничиваются
+	Allowlist []string `json:"allowlist"`
+	// FailureMode - что делать, пока Redis недоступен: memory, open или closed
+	FailureMode string `json:"failure_mode"`
+	// Breaker - после скольких ошибок Redis подряд и на сколько перестать к нему обращаться
+	Breaker BreakerRule `json:"breaker"`
+	// RedisTimeout - сколько ждать ответа Redis на одну проверку
+	RedisTimeout Duration `json:"redis_timeout"`
+
+	allowlist auth.Policy
+}
+
+// BreakerRule - настройки автомата защиты
+type BreakerRule struct {
+	Failures int      `json:"failures"`
+	Cooldown Duration `json:"cooldown"`
+}
+
+// Request - то, по чему выбираются лимиты запроса
+type Request struct {
+	Method string
+	Path   string
+	Tier   string
+	// Subject - кого считаем: "key:<id>", "partner:<id>" для ключей и JWT, иначе "ip:<адрес>"
+	Subject string
+}
+
+// Limit - лимит, который нужно проверить для запроса
+type Limit struct {
+	// Name - откуда взят лимит: "route:<name>", "key:<id>", "tier:<tier>", "default" или "auth"
+	Name string
+	// Key - ключ счётчика в Redis
+	Key string
+	Rule
+}
+
+// DefaultConfig - 30 запросов в минуту по IP и 10 неудачных попыток аутентификации в минуту с адреса,
+// проверки здоровья и метрики не ограничиваются. Без Redis лимиты считаются в памяти; после 5 ошибок подряд Redis не опрашивается 10 секунд.
+func DefaultConfig() Config {
+	return Config{
+		Algorithm:    AlgorithmSlidingWindow,
+		Default:      Rule{Limit: 30, Window: Duration(time.Minute)},
+		Auth:         Rule{Limit: 10, Window: Duration(time.Minute)},
+		Exempt:       []string{"/api/v1/health", "/api/v1/metrics"},
+		FailureMode:  FailureModeMemory,
+		Breaker:      BreakerRule{Failures: 5, Cooldown: Duration(10 * time.Second)},
+		RedisTimeout: Duration(200 * time.Millisecond),
+	}
+}
+
+// LoadConfig читает политики из JSON-файла поверх DefaultConfig
+func LoadConfig(file string) (Config, error) {
+	cfg := DefaultConfig()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return cfg, cfg.Prepare()
+}
+
+// Prepare проверяет политики и разбирает список разрешённых адресов
+func (cfg *Config) Prepare() error {
+	if _, err := New(cfg.Algorithm, nil); err != nil {
+		return err
+	}
+	if err := validMode(cfg.FailureMode); err != nil {
+		return err
+	}
+	if cfg.Breaker.Failures < 1 || cfg.Breaker.Cooldown <= 0 {
+		return fmt.Errorf("breaker: нужны failures > 0 и cooldown")
+	}
+	if err := cfg.Default.validate("default"); err != nil {
+		return err
+	}
+	if err := cfg.Auth.validate("auth"); err != nil {
+		return err
+	}
+	for tier, rule := range cfg.Tiers {
+		if tier != TierAnonymous && tier != TierPartner && tier != TierInternal {
+			return fmt.Errorf("неизвестный уровень %q", tier)
+		}
+		if err := rule.validate("tiers." + tier); err != nil {
+			return err
+		}
+	}
+	for key, rule := range cfg.Keys {
+		if !strings.HasPrefix(key, "key:") && !strings.HasPrefix(key, "partner:") {
+			return fmt.Errorf("ключ лимита %q должен начинаться с key: или partner:", key)
+		}
+		if err := rule.validate("keys." + key); err != nil {
+			return err
+		}
+	}
+	for _, route := range cfg.Routes {
+		if route.Name == "" || route.Pattern == "" {
+			return fmt.Errorf("у лимита маршрута должны быть name и pattern")
+		}
+		if err := route.validate("routes." + route.Name); err != nil {
+			return err
+		}
+	}
+
+	nets, err := auth.ParseNets(cfg.Allowlist)
+	if err != nil {
+		return fmt.Errorf("allowlist: %w", err)
+	}
+	cfg.allowlist = auth.Policy{Kind: auth.PolicyIP, Nets: nets}
+	return nil
+}
+
+func (r Rule) validate(name string) error {
+	if r.Limit < 0 {
+		return fmt.Errorf("%s: лимит не может быть отрицательным", name)
+	}
+	if r.Limit > 0 && r.Window <= 0 {
+		return fmt.Errorf("%s: не задано окно", name)
+	}
+	return nil
+}
+
+// IsExempt проверяет, что запрос не ограничивается: маршрут в Exempt или адрес в Allowlist
+func (cfg *Config) IsExempt(method, requestPath, ip string) bool {
+	for _, pattern := range cfg.Exempt {
+		if matchRoute(pattern, method, requestPath) {
+			return true
+		}
+	}
+	return cfg.allowlist.AllowsIP(ip)
+}
+
+// Limits возвращает лимиты, которые нужно проверить для запроса
+func (cfg *Config) Limits(req Request) []Limit {
+	var limits []Limit
+
+	// Лимит маршрута считается отдельно для каждого клиента
+	for _, route := range cfg.Routes {
+		if matchRoute(route.Pattern, req.Method, req.Path) {
+			limits = append(limits, Limit{Name: "route:" + route.Name, Key: "ratelimit:route:" + route.Name + ":" + req.Subject, Rule: route.Rule})
+			break
+		}
+	}
+
+	if rule, ok := cfg.Keys[req.Subject]; ok {
+		limits = append(limits, Limit{Name: req.Subject, Key: "ratelimit:" + req.Subject, Rule: rule})
+	} else if rule, ok := cfg.Tiers[req.Tier]; ok {
+		limits = append(limits, Limit{Name: "tier:" + req.Tier, Key: "ratelimit:tier:" + req.Tier + ":" + req.Subject, Rule: rule})
+	} else {
+		limits = append(limits, Limit{Name: "default", Key: "ratelimit:" + req.Subject, Rule: cfg.Default})
+	}
+
+	// Лимит 0 означает «без ограничений»
+	active := limits[:0]
+	for _, limit := range limits {
+		if limit.Limit > 0 {
+			active = append(active, limit)
+		}
+	}
+	return active
+}
+
+// AuthLimit возвращает лимит неудачных попыток аутентификации с адреса, если он задан
+func (cfg *Config) AuthLimit(ip string) (Limit, bool) {
+	return Limit{Name: "auth", Key: "ratelimit:auth:ip:" + ip, Rule: cfg.Auth}, cfg.Auth.Limit > 0
+}
+
+// Check возвращает проверку лимита для Limiter
+func (l Limit) Check() Check {
+	return Check{Key: l.Key, Limit: l.Limit, Window: time.Duration(l.Window)}
+}
+
+// matchRoute сравнивает запрос с шаблоном "[METHOD ]/path"
+func matchRoute(pattern, method, requestPath string) bool {
+	if verb, rest, ok := strings.Cut(pattern, " "); ok {
+		if !strings.EqualFold(verb, method) {
+			return false
+		}
+		pattern = strings.TrimSpace(rest)
+	}
+
+	requestPath = strings.TrimSuffix(requestPath, "/")
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		// Сравниваем с шаблоном столько первых сегментов пути, сколько их в префиксе
+		segments := strings.Count(prefix, "/")
+		parts := strings.SplitN(requestPath, "/", segments+2)
+		if len(parts) < segments+1 {
+			return false
+		}
+		matched, _ := path.Match(prefix, strings.Join(parts[:segments+1], "/"))
+		return matched
+	}
+
+	matched, _ := path.Match(pattern, requestPath)
+	return matched
+}
+
+// LocalsKey - ключ в c.Locals, под которым RateLimiter сохраняет квоту запроса
+const LocalsKey = "ratelimit"
+
+// Quota - состояние лимитов клиента после текущего запроса
+type Quota struct {
+	Tier    string
+	Subject string
+	// Exempt - запрос не ограничивается (маршрут из Exempt или адрес из Allowlist)
+	Exempt bool
+	// Degraded - Redis недоступен, лимиты считаются по режиму отказа
+	Degraded bool
+	Limits   []LimitStatus
+}
+
+// LimitStatus - состояние одного лимита
+type LimitStatus struct {
+	Limit
+	Result
+}
+
+// Tightest возвращает лимит, по которому осталось меньше всего запросов
+func (q *Quota) Tightest() (LimitStatus, bool) {
+	if len(q.Limits) == 0 {
+		return LimitStatus{}, false
+	}
+	tightest := q.Limits[0]
+	for _, status := range q.Limits[1:] {
+		if status.Remaining < tightest.Remaining {
+			tightest = status
+		}
+	}
+	return tightest, true
+}
@@ -0,0 +1,70 @@
+package ratelimit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"geo_offers/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoadConfig проверяет чтение политик из файла поверх значений по умолчанию.
+func TestLoadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ratelimit.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{
+		"tiers": {"partner": {"limit": 300, "window": "1m"}, "internal": {"limit": 0}},
+		"keys": {"key:7": {"limit": 1000, "window": "1m"}},
+		"routes": [{"name": "sync", "pattern": "POST /sync-offers", "limit": 1, "window": "10m"}],
+		"allowlist": ["10.0.0.0/8"]
+	}`), 0o600))
+
+	cfg, err := ratelimit.LoadConfig(file)
+	assert.NoError(t, err)
+	assert.Equal(t, ratelimit.AlgorithmSlidingWindow, cfg.Algorithm)
+	assert.Equal(t, 30, cfg.Default.Limit)
+	assert.Equal(t, ratelimit.Duration(10*time.Minute), cfg.Routes[0].Window)
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"tiers": {"vip": {"limit": 1, "window": "1m"}}}`), 0o600))
+	_, err = ratelimit.LoadConfig(file)
+	assert.Error(t, err)
+}
+
+// TestLimits проверяет выбор лимитов: маршрут, персональный лимит ключа, уровень и общий лимит.
+func TestLimits(t *testing.T) {
+	cfg := ratelimit.DefaultConfig()
+	cfg.Tiers = map[string]ratelimit.Rule{
+		ratelimit.TierPartner:  {Limit: 300, Window: ratelimit.Duration(time.Minute)},
+		ratelimit.TierInternal: {Limit: 0},
+	}
+	cfg.Keys = map[string]ratelimit.Rule{"key:7": {Limit: 1000, Window: ratelimit.Duration(time.Minute)}}
+	cfg.Routes = []ratelimit.RouteRule{{Name: "names", Pattern: "PUT /offers/*/names/*", Rule: ratelimit.Rule{Limit: 5, Window: ratelimit.Duration(time.Minute)}}}
+	cfg.Allowlist = []string{"10.0.0.0/8"}
+	assert.NoError(t, cfg.Prepare())
+
+	names := func(limits []ratelimit.Limit) []string {
+		result := []string{}
+		for _, limit := range limits {
+			result = append(result, limit.Name)
+		}
+		return result
+	}
+
+	anonymous := ratelimit.Request{Method: "GET", Path: "/api/v1/offers/RU", Tier: ratelimit.TierAnonymous, Subject: "ip:1.2.3.4"}
+	assert.Equal(t, []string{"default"}, names(cfg.Limits(anonymous)))
+	assert.Equal(t, "ratelimit:ip:1.2.3.4", cfg.Limits(anonymous)[0].Key)
+
+	partner := ratelimit.Request{Method: "PUT", Path: "/offers/12/names/en", Tier: ratelimit.TierPartner, Subject: "key:3"}
+	assert.Equal(t, []string{"route:names", "tier:partner"}, names(cfg.Limits(partner)))
+
+	personal := ratelimit.Request{Method: "GET", Path: "/api/v1/offers/RU", Tier: ratelimit.TierPartner, Subject: "key:7"}
+	assert.Equal(t, []string{"key:7"}, names(cfg.Limits(personal)))
+
+	internal := ratelimit.Request{Method: "GET", Path: "/api/v1/offers/RU", Tier: ratelimit.TierInternal, Subject: "key:1"}
+	assert.Empty(t, cfg.Limits(internal))
+
+	assert.True(t, cfg.IsExempt("GET", "/api/v1/health", "1.2.3.4"))
+	assert.True(t, cfg.IsExempt("GET", "/api/v1/offers/RU", "10.1.2.3"))
+	assert.False(t, cfg.IsExempt("GET", "/api/v1/offers/RU", "1.2.3.4"))
+}
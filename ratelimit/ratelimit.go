@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Алгоритмы ограничения запросов
+const (
+	// AlgorithmSlidingWindow - скользящее окно: не больше limit запросов за любые window подряд
+	AlgorithmSlidingWindow = "sliding_window"
+	// AlgorithmTokenBucket - корзина токенов: limit токенов, равномерно пополняется за window
+	AlgorithmTokenBucket = "token_bucket"
+)
+
+// Result - решение лимитера по одному лимиту запроса
+type Result struct {
+	// Allowed - запрос укладывается в этот лимит
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter - через сколько лимит полностью восстановится
+	ResetAfter time.Duration
+	// RetryAfter - через сколько можно повторить отклонённый запрос
+	RetryAfter time.Duration
+}
+
+// Check - лимит, который проверяется для запроса
+type Check struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+	// Peek - только проверить лимит, не учитывая в нём запрос
+	Peek bool
+}
+
+// Limiter считает запросы по ключам. Все лимиты запроса проверяются и учитываются атомарно одним Lua-скриптом:
+// запрос учитывается в счётчиках, только если проходит по каждому лимиту, поэтому отказ по одному лимиту
+// не расходует остальные. Result в ответе идут в порядке checks.
+type Limiter interface {
+	AllowAll(ctx context.Context, checks []Check) ([]Result, error)
+}
+
+// allowOne проверяет и учитывает один лимит
+func allowOne(ctx context.Context, limiter Limiter, key string, limit int, window time.Duration) (Result, error) {
+	results, err := limiter.AllowAll(ctx, []Check{{Key: key, Limit: limit, Window: window}})
+	if err != nil {
+		return Result{Limit: limit}, err
+	}
+	return results[0], nil
+}
+
+// Allowed сообщает, что запрос прошёл по всем лимитам
+func Allowed(results []Result) bool {
+	for _, result := range results {
+		if !result.Allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptArgs раскладывает лимиты в KEYS и тройки ARGV {window_ms, limit, consume} после общих аргументов
+func scriptArgs(checks []Check, args ...interface{}) ([]string, []interface{}) {
+	keys := make([]string, len(checks))
+	for i, check := range checks {
+		keys[i] = check.Key
+		consume := 1
+		if check.Peek {
+			consume = 0
+		}
+		args = append(args, check.Window.Milliseconds(), check.Limit, consume)
+	}
+	return keys, args
+}
+
+// New создаёт лимитер по названию алгоритма
+func New(algorithm string, client redis.Scripter) (Limiter, error) {
+	switch algorithm {
+	case "", AlgorithmSlidingWindow:
+		return NewSlidingWindow(client), nil
+	case AlgorithmTokenBucket:
+		return NewTokenBucket(client), nil
+	}
+	return nil, fmt.Errorf("неизвестный алгоритм ограничения запросов %q", algorithm)
+}
+
+// toResults разбирает ответ скрипта: по четвёрке {allowed, remaining, reset_ms, retry_ms} на каждый лимит
+func toResults(reply interface{}, checks []Check) ([]Result, error) {
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4*len(checks) {
+		return nil, fmt.Errorf("неожиданный ответ скрипта ограничения: %v", reply)
+	}
+
+	numbers := make([]int64, len(values))
+	for i, value := range values {
+		number, ok := value.(int64)
+		if !ok {
+			return nil, fmt.Errorf("неожиданный ответ скрипта ограничения: %v", reply)
+		}
+		numbers[i] = number
+	}
+
+	results := make([]Result, len(checks))
+	for i, check := range checks {
+		n := numbers[4*i : 4*i+4]
+		results[i] = Result{
+			Allowed:    n[0] == 1,
+			Limit:      check.Limit,
+			Remaining:  int(n[1]),
+			ResetAfter: time.Duration(n[2]) * time.Millisecond,
+			RetryAfter: time.Duration(n[3]) * time.Millisecond,
+		}
+	}
+	return results, nil
+}
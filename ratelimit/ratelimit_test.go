@@ -0,0 +1,149 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"geo_offers/ratelimit"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	t.Cleanup(mr.Close)
+	return mr, redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+// TestSlidingWindow проверяет, что окно не пропускает всплеск на границе и освобождается по мере выпадения запросов.
+func TestSlidingWindow(t *testing.T) {
+	mr, rdb := newRedis(t)
+	ctx := context.Background()
+
+	now := time.Unix(1_700_000_000, 0)
+	limiter := ratelimit.NewSlidingWindow(rdb)
+	limiter.Now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(ctx, "ip", 3, time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2-i, result.Remaining)
+	}
+
+	result, err := limiter.Allow(ctx, "ip", 3, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Minute, result.RetryAfter)
+
+	// Фиксированное окно здесь бы уже сбросилось, скользящее - нет
+	now = now.Add(59 * time.Second)
+	result, err = limiter.Allow(ctx, "ip", 3, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	now = now.Add(time.Second)
+	result, err = limiter.Allow(ctx, "ip", 3, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// У ключа всегда есть TTL, поэтому «вечной» блокировки не бывает
+	assert.Greater(t, mr.TTL("ip"), time.Duration(0))
+}
+
+// TestTokenBucket проверяет всплеск до ёмкости и равномерное пополнение токенов.
+func TestTokenBucket(t *testing.T) {
+	mr, rdb := newRedis(t)
+	ctx := context.Background()
+
+	now := time.Unix(1_700_000_000, 0)
+	limiter := ratelimit.NewTokenBucket(rdb)
+	limiter.Now = func() time.Time { return now }
+
+	for i := 0; i < 6; i++ {
+		result, err := limiter.Allow(ctx, "key", 6, time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+
+	result, err := limiter.Allow(ctx, "key", 6, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	// Один токен пополняется за 10 секунд
+	assert.Equal(t, 10*time.Second, result.RetryAfter)
+
+	now = now.Add(10 * time.Second)
+	result, err = limiter.Allow(ctx, "key", 6, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	assert.Greater(t, mr.TTL("key"), time.Duration(0))
+}
+
+// TestAllowAll проверяет, что запрос учитывается в счётчиках, только если проходит по всем лимитам,
+// а лимит с Peek только проверяется.
+func TestAllowAll(t *testing.T) {
+	_, rdb := newRedis(t)
+	now := time.Unix(1_700_000_000, 0)
+
+	sliding := ratelimit.NewSlidingWindow(rdb)
+	sliding.Now = func() time.Time { return now }
+	bucket := ratelimit.NewTokenBucket(rdb)
+	bucket.Now = func() time.Time { return now }
+	memory := ratelimit.NewMemory()
+	memory.Now = func() time.Time { return now }
+
+	limiters := map[string]ratelimit.Limiter{"sliding_window": sliding, "token_bucket": bucket, "memory": memory}
+	for name, limiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			checks := []ratelimit.Check{
+				{Key: name + ":route", Limit: 5, Window: time.Minute},
+				{Key: name + ":client", Limit: 1, Window: time.Minute},
+				{Key: name + ":auth", Limit: 1, Window: time.Minute, Peek: true},
+			}
+
+			results, err := limiter.AllowAll(ctx, checks)
+			assert.NoError(t, err)
+			assert.True(t, ratelimit.Allowed(results))
+			assert.Equal(t, 4, results[0].Remaining)
+			assert.Equal(t, 0, results[1].Remaining)
+			assert.Equal(t, 1, results[2].Remaining)
+
+			// Лимит клиента исчерпан: лимит маршрута не расходуется
+			results, err = limiter.AllowAll(ctx, checks)
+			assert.NoError(t, err)
+			assert.False(t, ratelimit.Allowed(results))
+			assert.True(t, results[0].Allowed)
+			assert.Equal(t, 4, results[0].Remaining)
+			assert.False(t, results[1].Allowed)
+			assert.Equal(t, time.Minute, results[1].RetryAfter)
+
+			results, err = limiter.AllowAll(ctx, checks[:1])
+			assert.NoError(t, err)
+			assert.True(t, results[0].Allowed)
+			assert.Equal(t, 3, results[0].Remaining)
+		})
+	}
+}
+
+// TestNew проверяет выбор алгоритма по названию.
+func TestNew(t *testing.T) {
+	_, rdb := newRedis(t)
+
+	limiter, err := ratelimit.New("", rdb)
+	assert.NoError(t, err)
+	assert.IsType(t, &ratelimit.SlidingWindow{}, limiter)
+
+	limiter, err = ratelimit.New(ratelimit.AlgorithmTokenBucket, rdb)
+	assert.NoError(t, err)
+	assert.IsType(t, &ratelimit.TokenBucket{}, limiter)
+
+	_, err = ratelimit.New("fixed_window", rdb)
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindowScript хранит метки времени запросов в ZSET и отбрасывает те, что старше окна.
+// Сначала проверяются все ключи, и только если запрос проходит по каждому, он добавляется в окна.
+// KEYS - ключи лимитов; ARGV: now_ms, member, затем на каждый ключ window_ms, limit, consume
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local member = ARGV[2]
+
+local counts = {}
+local allowed = 1
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[3 * i])
+	local limit = tonumber(ARGV[3 * i + 1])
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	counts[i] = redis.call('ZCARD', key)
+	if counts[i] >= limit then
+		allowed = 0
+	end
+end
+
+local reply = {}
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[3 * i])
+	local limit = tonumber(ARGV[3 * i + 1])
+	local count = counts[i]
+	if allowed == 1 and ARGV[3 * i + 2] == '1' then
+		redis.call('ZADD', key, now, member)
+		count = count + 1
+	end
+	redis.call('PEXPIRE', key, window)
+
+	-- Окно освобождается, когда из него выпадает самый старый запрос
+	local reset = 0
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	if oldest[2] then
+		reset = tonumber(oldest[2]) + window - now
+	end
+
+	local fits = 0
+	local retry = reset
+	if counts[i] < limit then
+		fits = 1
+		retry = 0
+	end
+
+	table.insert(reply, fits)
+	table.insert(reply, limit - count)
+	table.insert(reply, reset)
+	table.insert(reply, retry)
+end
+return reply
+`)
+
+// SlidingWindow - лимитер со скользящим окном (sliding log). Всплесков на границе окна, как у фиксированного окна, нет.
+type SlidingWindow struct {
+	client redis.Scripter
+	// Now - источник времени, подменяется в тестах
+	Now func() time.Time
+}
+
+func NewSlidingWindow(client redis.Scripter) *SlidingWindow {
+	return &SlidingWindow{client: client, Now: time.Now}
+}
+
+func (l *SlidingWindow) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	return allowOne(ctx, l, key, limit, window)
+}
+
+func (l *SlidingWindow) AllowAll(ctx context.Context, checks []Check) ([]Result, error) {
+	now := l.Now().UnixMilli()
+	// Член ZSET должен быть уникальным даже для запросов в одну миллисекунду
+	member := fmt.Sprintf("%d-%d", now, rand.Uint64())
+
+	keys, args := scriptArgs(checks, now, member)
+	reply, err := slidingWindowScript.Run(ctx, l.client, keys, args...).Result()
+	if err != nil {
+		return nil, err
+	}
+	return toResults(reply, checks)
+}
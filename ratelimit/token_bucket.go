@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript хранит в HASH остаток токенов и время последнего пополнения.
+// Токен списывается из каждой корзины, только если он есть во всех.
+// KEYS - ключи лимитов; ARGV: now_ms, затем на каждый ключ window_ms, limit, consume
+var tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+
+local tokens = {}
+local allowed = 1
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[3 * i - 1])
+	local capacity = tonumber(ARGV[3 * i])
+	local state = redis.call('HMGET', key, 'tokens', 'ts')
+	local left = tonumber(state[1])
+	local ts = tonumber(state[2])
+	if left == nil then
+		left = capacity
+		ts = now
+	end
+	tokens[i] = math.min(capacity, left + math.max(0, now - ts) * capacity / window)
+	if tokens[i] < 1 then
+		allowed = 0
+	end
+end
+
+local reply = {}
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[3 * i - 1])
+	local capacity = tonumber(ARGV[3 * i])
+	local rate = capacity / window
+	local left = tokens[i]
+	if allowed == 1 and ARGV[3 * i + 1] == '1' then
+		left = left - 1
+	end
+
+	redis.call('HSET', key, 'tokens', tostring(left), 'ts', now)
+	redis.call('PEXPIRE', key, window)
+
+	local fits = 0
+	local retry = math.ceil((1 - tokens[i]) / rate)
+	if tokens[i] >= 1 then
+		fits = 1
+		retry = 0
+	end
+
+	table.insert(reply, fits)
+	table.insert(reply, math.floor(left))
+	table.insert(reply, math.ceil((capacity - left) / rate))
+	table.insert(reply, retry)
+end
+return reply
+`)
+
+// TokenBucket - лимитер «корзина токенов»: допускает всплеск до limit запросов, дальше - limit запросов за window.
+type TokenBucket struct {
+	client redis.Scripter
+	// Now - источник времени, подменяется в тестах
+	Now func() time.Time
+}
+
+func NewTokenBucket(client redis.Scripter) *TokenBucket {
+	return &TokenBucket{client: client, Now: time.Now}
+}
+
+func (l *TokenBucket) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	return allowOne(ctx, l, key, limit, window)
+}
+
+func (l *TokenBucket) AllowAll(ctx context.Context, checks []Check) ([]Result, error) {
+	keys, args := scriptArgs(checks, l.Now().UnixMilli())
+	reply, err := tokenBucketScript.Run(ctx, l.client, keys, args...).Result()
+	if err != nil {
+		return nil, err
+	}
+	return toResults(reply, checks)
+}
@@ -0,0 +1,43 @@
+package requestlog
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Redacted - чем заменяется значение чувствительного параметра
+const Redacted = "REDACTED"
+
+// DefaultSensitiveParams - параметры запроса, значения которых не сохраняются в журнал
+var DefaultSensitiveParams = []string{
+	"api_key", "apikey", "key", "token", "access_token", "refresh_token",
+	"signature", "sig", "password", "secret", "auth", "authorization",
+}
+
+// redactQuery заменяет значения чувствительных параметров в строке запроса.
+// Имена сравниваются без учёта регистра, порядок и остальные параметры сохраняются как есть.
+func redactQuery(query string, sensitive map[string]bool) string {
+	if query == "" {
+		return ""
+	}
+
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		name, _, hasValue := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if hasValue && sensitive[strings.ToLower(name)] {
+			parts[i] = part[:strings.IndexByte(part, '=')+1] + Redacted
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func sensitiveSet(params []string) map[string]bool {
+	set := make(map[string]bool, len(params))
+	for _, param := range params {
+		set[strings.ToLower(strings.TrimSpace(param))] = true
+	}
+	return set
+}
@@ -0,0 +1,287 @@
+package requestlog
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"geo_offers/config"
+	"geo_offers/metrics"
+	"geo_offers/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+var prunedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "request_log_pruned_total",
+		Help: "Записи журнала запросов, удалённые по сроку хранения, по способу удаления",
+	},
+	[]string{"method"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(prunedTotal)
+}
+
+// Имена служебных партиций request_logs: записи до включения партиций и записи за днями, для которых партиций ещё нет
+const (
+	partitionHistory = "p_history"
+	partitionFuture  = "p_future"
+)
+
+// RetentionOptions - срок хранения журнала запросов
+type RetentionOptions struct {
+	// Days - сколько полных дней хранить записи, 0 - хранить всё
+	Days int
+	// Interval - как часто запускается очистка
+	Interval time.Duration
+	// ChunkSize - сколько записей удаляется одним DELETE, чтобы не держать долгие блокировки
+	ChunkSize int
+	// Rollup - перед удалением сворачивать записи в дневные агрегаты (request_log_dailies)
+	Rollup bool
+	// Partitions - только MySQL: делить таблицу на дневные партиции и удалять старые дни через DROP PARTITION
+	Partitions bool
+	// PartitionsAhead - на сколько дней вперёд заводить партиции
+	PartitionsAhead int
+}
+
+// DefaultRetentionOptions - записи хранятся бессрочно; если срок задан, очистка раз в час по 5000 записей
+// со сворачиванием в дневные агрегаты
+func DefaultRetentionOptions() RetentionOptions {
+	return RetentionOptions{Interval: time.Hour, ChunkSize: 5000, Rollup: true, PartitionsAhead: 3}
+}
+
+// Pruner удаляет из журнала запросов записи старше срока хранения
+type Pruner struct {
+	db      *gorm.DB
+	options RetentionOptions
+	// Now - текущее время, подменяется в тестах
+	Now func() time.Time
+}
+
+// NewPruner проверяет настройки и создаёт Pruner
+func NewPruner(db *gorm.DB, options RetentionOptions) (*Pruner, error) {
+	if options.Days < 0 || options.Interval <= 0 || options.ChunkSize < 1 || options.PartitionsAhead < 0 {
+		return nil, fmt.Errorf("срок хранения и число партиций не могут быть отрицательными, интервал и размер пачки должны быть положительными")
+	}
+	if options.Partitions && db.Dialector.Name() != "mysql" {
+		return nil, fmt.Errorf("партиции поддерживаются только в MySQL")
+	}
+	return &Pruner{db: db, options: options, Now: time.Now}, nil
+}
+
+// Run выполняет очистку сразу и затем каждые Interval, пока не отменён ctx
+func (p *Pruner) Run(ctx context.Context) {
+	if p.options.Days == 0 && !p.options.Partitions {
+		return
+	}
+
+	ticker := time.NewTicker(p.options.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Prune(ctx); err != nil && ctx.Err() == nil {
+			config.Log("requestlog").ErrorContext(ctx, "Ошибка очистки журнала запросов", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune заводит партиции на ближайшие дни, сворачивает в агрегаты и удаляет записи старше срока хранения.
+// Срок считается полными днями: удаляется всё, что раньше начала дня (сегодня - Days).
+func (p *Pruner) Prune(ctx context.Context) error {
+	db := p.db.WithContext(ctx)
+	now := p.Now()
+	today := startOfDay(now)
+
+	if p.options.Partitions {
+		if err := p.ensurePartitions(db, today); err != nil {
+			return fmt.Errorf("партиции: %w", err)
+		}
+	}
+	if p.options.Days == 0 {
+		return nil
+	}
+	cutoff := today.AddDate(0, 0, -p.options.Days)
+
+	if p.options.Rollup {
+		if err := p.rollup(db, cutoff); err != nil {
+			return fmt.Errorf("агрегаты: %w", err)
+		}
+	}
+	if p.options.Partitions {
+		if err := p.dropPartitions(db, cutoff); err != nil {
+			return fmt.Errorf("удаление партиций: %w", err)
+		}
+	}
+	// Без партиций, а с ними - для записей из p_history, удаляем пачками
+	return p.deleteChunks(ctx, db, cutoff)
+}
+
+// rollup сворачивает в request_log_dailies каждый день до cutoff, за который агрегатов ещё нет.
+// Если прошлая очистка прервалась на удалении, день уже свёрнут и повторно не считается.
+// У записей, сделанных до появления колонки route, вместо шаблона маршрута берётся путь.
+func (p *Pruner) rollup(db *gorm.DB, cutoff time.Time) error {
+	var oldest models.RequestLog
+	result := db.Select("created_at").Where("created_at < ?", cutoff).Order("created_at").Limit(1).Find(&oldest)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	for day := startOfDay(oldest.CreatedAt.In(cutoff.Location())); day.Before(cutoff); day = day.AddDate(0, 0, 1) {
+		var done int64
+		if err := db.Model(&models.RequestLogDaily{}).Where("day = ?", day).Count(&done).Error; err != nil {
+			return err
+		}
+		if done > 0 {
+			continue
+		}
+
+		err := db.Exec(`INSERT INTO request_log_dailies
+			(day, method, route, status_code, geo, api_key_id, requests, cache_hits, latency_sum_ms, latency_max_ms, request_bytes, response_bytes)
+			SELECT ?, method, COALESCE(NULLIF(route, ''), endpoint), status_code, geo, COALESCE(api_key_id, 0), COUNT(*),
+				SUM(CASE WHEN cache_hit THEN 1 ELSE 0 END), SUM(latency_ms), MAX(latency_ms), SUM(request_bytes), SUM(response_bytes)
+			FROM request_logs
+			WHERE created_at >= ? AND created_at < ?
+			GROUP BY method, COALESCE(NULLIF(route, ''), endpoint), status_code, geo, COALESCE(api_key_id, 0)`,
+			day, day, day.AddDate(0, 0, 1)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteChunks удаляет записи до cutoff пачками по ChunkSize
+func (p *Pruner) deleteChunks(ctx context.Context, db *gorm.DB, cutoff time.Time) error {
+	var deleted int64
+	for ctx.Err() == nil {
+		var ids []uint
+		if err := db.Model(&models.RequestLog{}).Where("created_at < ?", cutoff).Order("id").Limit(p.options.ChunkSize).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		result := db.Where("id IN ?", ids).Delete(&models.RequestLog{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted += result.RowsAffected
+		prunedTotal.WithLabelValues("delete").Add(float64(result.RowsAffected))
+	}
+
+	if deleted > 0 {
+		config.Log("requestlog").InfoContext(ctx, "Удалены старые записи журнала запросов", "count", deleted, "before", cutoff)
+	}
+	return ctx.Err()
+}
+
+// ensurePartitions переводит request_logs на дневные партиции (один раз, таблица перестраивается целиком)
+// и заводит партиции до today + PartitionsAhead
+func (p *Pruner) ensurePartitions(db *gorm.DB, today time.Time) error {
+	days, err := partitionDays(db, today.Location())
+	if err != nil {
+		return err
+	}
+
+	last := today.AddDate(0, 0, p.options.PartitionsAhead)
+	if days == nil {
+		// Ключ партиционирования должен входить в первичный ключ
+		sql := "ALTER TABLE request_logs DROP PRIMARY KEY, ADD PRIMARY KEY (id, created_at) PARTITION BY RANGE (TO_DAYS(created_at)) (" +
+			fmt.Sprintf("PARTITION %s VALUES LESS THAN (TO_DAYS('%s')), ", partitionHistory, today.Format(time.DateOnly)) +
+			dayPartitions(today, last) + ")"
+		if err := db.Exec(sql).Error; err != nil {
+			return err
+		}
+		config.Log("requestlog").Info("Журнал запросов разбит на дневные партиции", "until", last.Format(time.DateOnly))
+		return nil
+	}
+
+	// Продолжаем с дня после последней партиции, чтобы дни простоя тоже получили свои партиции
+	next := today
+	if len(days) > 0 {
+		next = days[len(days)-1].AddDate(0, 0, 1)
+	}
+	if next.After(last) {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("ALTER TABLE request_logs REORGANIZE PARTITION %s INTO (%s)", partitionFuture, dayPartitions(next, last))).Error
+}
+
+// dropPartitions удаляет партиции дней до cutoff
+func (p *Pruner) dropPartitions(db *gorm.DB, cutoff time.Time) error {
+	days, err := partitionDays(db, cutoff.Location())
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, day := range days {
+		if day.Before(cutoff) {
+			names = append(names, partitionName(day))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	// Считаем только записи удаляемых партиций: записи p_history удалит deleteChunks и посчитает сам.
+	// days отсортированы, поэтому days[0] - первый удаляемый день.
+	var rows int64
+	if err := db.Model(&models.RequestLog{}).Where("created_at >= ? AND created_at < ?", days[0], cutoff).Count(&rows).Error; err != nil {
+		return err
+	}
+	if err := db.Exec("ALTER TABLE request_logs DROP PARTITION " + strings.Join(names, ", ")).Error; err != nil {
+		return err
+	}
+	prunedTotal.WithLabelValues("drop_partition").Add(float64(rows))
+	config.Log("requestlog").Info("Удалены партиции журнала запросов", "partitions", names)
+	return nil
+}
+
+// partitionDays возвращает дни, для которых есть партиции, по возрастанию.
+// nil - таблица ещё не разбита на партиции.
+func partitionDays(db *gorm.DB, location *time.Location) ([]time.Time, error) {
+	var names []string
+	err := db.Raw(`SELECT PARTITION_NAME FROM information_schema.PARTITIONS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'request_logs' AND PARTITION_NAME IS NOT NULL`).Scan(&names).Error
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+
+	days := []time.Time{}
+	for _, name := range names {
+		if day, err := time.ParseInLocation("p20060102", name, location); err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+// dayPartitions - описание партиций с from по to включительно и p_future для всего, что позже
+func dayPartitions(from, to time.Time) string {
+	var parts []string
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		parts = append(parts, fmt.Sprintf("PARTITION %s VALUES LESS THAN (TO_DAYS('%s'))", partitionName(day), day.AddDate(0, 0, 1).Format(time.DateOnly)))
+	}
+	parts = append(parts, fmt.Sprintf("PARTITION %s VALUES LESS THAN MAXVALUE", partitionFuture))
+	return strings.Join(parts, ", ")
+}
+
+func partitionName(day time.Time) string {
+	return day.Format("p20060102")
+}
+
+func startOfDay(moment time.Time) time.Time {
+	year, month, day := moment.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, moment.Location())
+}
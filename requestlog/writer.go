@@ -0,0 +1,223 @@
+package requestlog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"geo_offers/config"
+	"geo_offers/metrics"
+	"geo_offers/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// Что делать с записью, когда очередь заполнена
+const (
+	// DropNewest - отбросить новую запись (по умолчанию)
+	DropNewest = "newest"
+	// DropOldest - вытеснить самую старую запись из очереди
+	DropOldest = "oldest"
+)
+
+// Ключи c.Locals, через которые обработчики дополняют запись журнала
+const (
+	// GeoKey - GEO или регион выдачи (string)
+	GeoKey = "requestlog_geo"
+	// CacheHitKey - ответ отдан из кеша (bool)
+	CacheHitKey = "requestlog_cache_hit"
+)
+
+var (
+	flushedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "request_log_flushed_total",
+			Help: "Записи журнала запросов, сохранённые в БД",
+		},
+	)
+
+	droppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "request_log_dropped_total",
+			Help: "Записи журнала запросов, которые не попали в БД, по причине",
+		},
+		[]string{"reason"},
+	)
+
+	queueLength = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "request_log_queue_length",
+			Help: "Записи журнала запросов, ожидающие сохранения",
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(flushedTotal, droppedTotal, queueLength)
+}
+
+// Options - настройки Writer
+type Options struct {
+	// QueueSize - сколько записей может ждать сохранения
+	QueueSize int
+	// BatchSize - сколько записей сохраняется одним INSERT
+	BatchSize int
+	// FlushInterval - как часто сохраняется неполная пачка
+	FlushInterval time.Duration
+	// DropPolicy - newest или oldest
+	DropPolicy string
+	// SensitiveParams - параметры запроса, значения которых заменяются на REDACTED
+	SensitiveParams []string
+}
+
+// DefaultOptions - очередь на 10000 записей, пачки по 200, не реже раза в секунду
+func DefaultOptions() Options {
+	return Options{
+		QueueSize:       10000,
+		BatchSize:       200,
+		FlushInterval:   time.Second,
+		DropPolicy:      DropNewest,
+		SensitiveParams: DefaultSensitiveParams,
+	}
+}
+
+// Writer сохраняет журнал запросов в БД пачками в фоне, чтобы INSERT не выполнялся на каждый запрос.
+// Очередь ограничена: если БД не успевает, записи отбрасываются по DropPolicy, а запросы не ждут.
+type Writer struct {
+	db        *gorm.DB
+	options   Options
+	sensitive map[string]bool
+	queue     chan models.RequestLog
+	done      chan struct{}
+	wg        sync.WaitGroup
+	once      sync.Once
+}
+
+// NewWriter создаёт Writer и запускает фоновую запись
+func NewWriter(db *gorm.DB, options Options) (*Writer, error) {
+	if options.QueueSize < 1 || options.BatchSize < 1 || options.FlushInterval <= 0 {
+		return nil, fmt.Errorf("размер очереди, размер пачки и интервал должны быть положительными")
+	}
+	if options.DropPolicy == "" {
+		options.DropPolicy = DropNewest
+	}
+	if options.DropPolicy != DropNewest && options.DropPolicy != DropOldest {
+		return nil, fmt.Errorf("неизвестная политика отбрасывания %q", options.DropPolicy)
+	}
+
+	w := &Writer{
+		db:        db,
+		options:   options,
+		sensitive: sensitiveSet(options.SensitiveParams),
+		queue:     make(chan models.RequestLog, options.QueueSize),
+		done:      make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Enqueue ставит запись в очередь. Не блокируется: при заполненной очереди запись отбрасывается по DropPolicy.
+func (w *Writer) Enqueue(entry models.RequestLog) {
+	select {
+	case <-w.done:
+		droppedTotal.WithLabelValues("closed").Inc()
+		return
+	default:
+	}
+
+	for {
+		select {
+		case w.queue <- entry:
+			queueLength.Set(float64(len(w.queue)))
+			return
+		default:
+		}
+
+		if w.options.DropPolicy == DropNewest {
+			droppedTotal.WithLabelValues("queue_full").Inc()
+			return
+		}
+		// Освобождаем место, вытесняя самую старую запись, и пробуем снова
+		select {
+		case <-w.queue:
+			droppedTotal.WithLabelValues("queue_full").Inc()
+		default:
+		}
+	}
+}
+
+// RedactQuery заменяет в строке запроса значения параметров из SensitiveParams
+func (w *Writer) RedactQuery(query string) string {
+	return redactQuery(query, w.sensitive)
+}
+
+// Close прекращает приём записей и сохраняет всё, что осталось в очереди.
+// Если ctx истекает раньше, оставшиеся записи теряются.
+func (w *Writer) Close(ctx context.Context) error {
+	w.once.Do(func() { close(w.done) })
+
+	finished := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("журнал запросов сохранён не полностью: %w", ctx.Err())
+	}
+}
+
+func (w *Writer) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.RequestLog, 0, w.options.BatchSize)
+	for {
+		select {
+		case entry := <-w.queue:
+			batch = append(batch, entry)
+			if len(batch) >= w.options.BatchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case <-w.done:
+			// Дописываем остаток очереди
+			for {
+				select {
+				case entry := <-w.queue:
+					batch = append(batch, entry)
+					if len(batch) >= w.options.BatchSize {
+						batch = w.flush(batch)
+					}
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush сохраняет пачку одним INSERT и возвращает пустой срез для следующей
+func (w *Writer) flush(batch []models.RequestLog) []models.RequestLog {
+	queueLength.Set(float64(len(w.queue)))
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := w.db.CreateInBatches(batch, len(batch)).Error; err != nil {
+		config.Log("requestlog").Error("Ошибка сохранения журнала запросов в БД", "count", len(batch), "error", err)
+		droppedTotal.WithLabelValues("db_error").Add(float64(len(batch)))
+	} else {
+		flushedTotal.Add(float64(len(batch)))
+	}
+	return batch[:0]
+}
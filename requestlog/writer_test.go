@@ -0,0 +1,142 @@
+package requestlog_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"geo_offers/models"
+	"geo_offers/requestlog"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	// Одно соединение, иначе у каждого будет своя in-memory база
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	assert.NoError(t, db.AutoMigrate(&models.RequestLog{}))
+	return db
+}
+
+func count(db *gorm.DB) int64 {
+	var n int64
+	db.Model(&models.RequestLog{}).Count(&n)
+	return n
+}
+
+// TestWriterFlush проверяет запись пачками по размеру и по интервалу.
+func TestWriterFlush(t *testing.T) {
+	db := setupDB(t)
+	writer, err := requestlog.NewWriter(db, requestlog.Options{QueueSize: 100, BatchSize: 3, FlushInterval: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	defer writer.Close(context.Background())
+
+	for i := 0; i < 4; i++ {
+		writer.Enqueue(models.RequestLog{Method: "GET", Endpoint: "/api/v1/ping", StatusCode: 200})
+	}
+
+	// Полная пачка пишется сразу, остаток - по интервалу
+	assert.Eventually(t, func() bool { return count(db) == 4 }, time.Second, 10*time.Millisecond)
+}
+
+// TestWriterDrain проверяет, что при остановке очередь дописывается в БД.
+func TestWriterDrain(t *testing.T) {
+	db := setupDB(t)
+	writer, err := requestlog.NewWriter(db, requestlog.Options{QueueSize: 1000, BatchSize: 100, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+
+	for i := 0; i < 250; i++ {
+		writer.Enqueue(models.RequestLog{Method: "GET", Endpoint: "/api/v1/ping", StatusCode: 200})
+	}
+	assert.NoError(t, writer.Close(context.Background()))
+	assert.Equal(t, int64(250), count(db))
+
+	// После остановки записи не принимаются
+	writer.Enqueue(models.RequestLog{Method: "GET"})
+	assert.Equal(t, int64(250), count(db))
+}
+
+// TestWriterOptions проверяет разбор настроек.
+func TestWriterOptions(t *testing.T) {
+	db := setupDB(t)
+
+	_, err := requestlog.NewWriter(db, requestlog.Options{QueueSize: 10, BatchSize: 1, FlushInterval: time.Second, DropPolicy: "random"})
+	assert.Error(t, err)
+
+	_, err = requestlog.NewWriter(db, requestlog.Options{QueueSize: 0, BatchSize: 1, FlushInterval: time.Second})
+	assert.Error(t, err)
+}
+
+// TestRedactQuery проверяет, что значения чувствительных параметров не попадают в журнал.
+func TestRedactQuery(t *testing.T) {
+	options := requestlog.DefaultOptions()
+	options.SensitiveParams = append(options.SensitiveParams, "partner_ref")
+	writer, err := requestlog.NewWriter(setupDB(t), options)
+	assert.NoError(t, err)
+	defer writer.Close(context.Background())
+
+	assert.Equal(t, "", writer.RedactQuery(""))
+	assert.Equal(t, "page=2&limit=10", writer.RedactQuery("page=2&limit=10"))
+	assert.Equal(t, "page=2&API_KEY=REDACTED&lang=en", writer.RedactQuery("page=2&API_KEY=abc123&lang=en"))
+	assert.Equal(t, "access%5Ftoken=REDACTED&partner_ref=REDACTED&flag", writer.RedactQuery("access%5Ftoken=x&partner_ref=42&flag"))
+}
+
+// TestPruner проверяет, что записи старше срока хранения сворачиваются в дневные агрегаты и удаляются пачками.
+func TestPruner(t *testing.T) {
+	db := setupDB(t)
+	assert.NoError(t, db.AutoMigrate(&models.RequestLogDaily{}))
+
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	keyID := uint(3)
+	var logs []models.RequestLog
+	for i := 0; i < 7; i++ {
+		endpoint := fmt.Sprintf("/offers/%d", i+1)
+		logs = append(logs, models.RequestLog{CreatedAt: time.Date(2026, 3, 1, 10, i, 0, 0, time.UTC), Method: "PATCH", Endpoint: endpoint, Route: "/offers/:id", StatusCode: 200, LatencyMs: float64(10 * (i + 1))})
+	}
+	logs = append(logs,
+		// Запись без шаблона маршрута (сделана до колонки route) сворачивается по пути
+		models.RequestLog{CreatedAt: time.Date(2026, 3, 2, 23, 0, 0, 0, time.UTC), Method: "POST", Endpoint: "/offers", StatusCode: 500, LatencyMs: 5, APIKeyID: &keyID},
+		models.RequestLog{CreatedAt: time.Date(2026, 3, 3, 1, 0, 0, 0, time.UTC), Method: "GET", Endpoint: "/api/v1/ping", StatusCode: 200},
+	)
+	assert.NoError(t, db.Create(&logs).Error)
+
+	options := requestlog.DefaultRetentionOptions()
+	options.Days = 7
+	options.ChunkSize = 3
+	pruner, err := requestlog.NewPruner(db, options)
+	assert.NoError(t, err)
+	pruner.Now = func() time.Time { return now }
+
+	// Хранятся дни с 3 марта: 1 и 2 марта сворачиваются и удаляются
+	assert.NoError(t, pruner.Prune(context.Background()))
+	assert.Equal(t, int64(1), count(db))
+
+	var daily []models.RequestLogDaily
+	assert.NoError(t, db.Order("day, route").Find(&daily).Error)
+	if assert.Len(t, daily, 2) {
+		assert.Equal(t, "/offers/:id", daily[0].Route)
+		assert.Equal(t, int64(7), daily[0].Requests)
+		assert.Equal(t, 280.0, daily[0].LatencySumMs)
+		assert.Equal(t, 70.0, daily[0].LatencyMaxMs)
+		assert.Equal(t, uint(3), daily[1].APIKeyID)
+		assert.Equal(t, "/offers", daily[1].Route)
+		assert.Equal(t, 500, daily[1].StatusCode)
+	}
+
+	// Повторный запуск не дублирует агрегаты
+	assert.NoError(t, pruner.Prune(context.Background()))
+	var dailyCount int64
+	db.Model(&models.RequestLogDaily{}).Count(&dailyCount)
+	assert.Equal(t, int64(2), dailyCount)
+
+	// Партиции есть только в MySQL
+	options.Partitions = true
+	_, err = requestlog.NewPruner(db, options)
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"geo_offers/models"
+	"gorm.io/gorm"
+)
+
+// Действия в журнале аудита
+const (
+	AuditCreate      = "create"
+	AuditUpdate      = "update"
+	AuditDelete      = "delete"
+	AuditSyncTrigger = "sync_trigger"
+)
+
+// ActorSync - тип субъекта для изменений, сделанных синхронизацией
+const ActorSync = "sync"
+
+// Actor - кто выполняет изменение
+type Actor struct {
+	Type      string
+	ID        string
+	RequestID string
+}
+
+// FieldChange - изменение одного поля
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// RecordAudit пишет событие в журнал аудита. before и after - состояние объекта до и после изменения
+// (nil для создания и удаления соответственно). Если объект по факту не изменился, событие не пишется.
+// changed сообщает, было ли изменение, даже если событие записать не удалось.
+// Вызывать лучше в той же транзакции, что и само изменение.
+func RecordAudit(tx *gorm.DB, actor Actor, action string, offerID int, before, after any) (changed bool, err error) {
+	beforeMap, err := toMap(before)
+	if err != nil {
+		return false, err
+	}
+	afterMap, err := toMap(after)
+	if err != nil {
+		return false, err
+	}
+
+	changes := diff(beforeMap, afterMap)
+	if action == AuditUpdate && len(changes) == 0 {
+		return false, nil
+	}
+
+	event := models.AuditEvent{
+		ActorType: actor.Type,
+		ActorID:   actor.ID,
+		Action:    action,
+		OfferID:   offerID,
+		RequestID: actor.RequestID,
+		Before:    marshal(beforeMap),
+		After:     marshal(afterMap),
+		Changes:   marshal(changes),
+	}
+	return true, tx.Create(&event).Error
+}
+
+// toMap приводит объект к map через JSON, чтобы сравнивать поля так, как их видит клиент API
+func toMap(value any) (map[string]any, error) {
+	if isNil(value) {
+		return nil, nil
+	}
+	if m, ok := value.(map[string]any); ok {
+		return m, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+func diff(before, after map[string]any) map[string]FieldChange {
+	changes := map[string]FieldChange{}
+	for field, to := range after {
+		if from, ok := before[field]; !ok || !reflect.DeepEqual(from, to) {
+			changes[field] = FieldChange{From: before[field], To: to}
+		}
+	}
+	for field, from := range before {
+		if _, ok := after[field]; !ok {
+			changes[field] = FieldChange{From: from}
+		}
+	}
+	return changes
+}
+
+func marshal(value any) string {
+	if isNil(value) {
+		return ""
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func isNil(value any) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+
+	"geo_offers/config"
+	"geo_offers/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Результат прогона синхронизации (метка result)
+const (
+	syncSucceeded = "success"
+	syncFailed    = "failed"
+)
+
+var (
+	syncDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sync_run_duration_seconds",
+			Help:    "Длительность прогона синхронизации офферов",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200},
+		},
+		[]string{"result"},
+	)
+
+	syncPages = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "sync_pages_total",
+			Help: "Страницы, загруженные из CityAds",
+		},
+	)
+
+	syncOffers = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sync_offers_total",
+			Help: "Офферы, созданные, изменённые и деактивированные синхронизацией",
+		},
+		[]string{"action"},
+	)
+
+	syncUpstreamErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sync_upstream_errors_total",
+			Help: "Ошибки запросов к CityAds: HTTP-код ответа, network или invalid_json",
+		},
+		[]string{"status"},
+	)
+
+	syncLastSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "sync_last_success_timestamp_seconds",
+			Help: "Время окончания последней успешной синхронизации (unix)",
+		},
+	)
+
+	offersByGeo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "offers",
+			Help: "Активные офферы в БД по GEO, обновляется после синхронизации",
+		},
+		[]string{"geo"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(syncDuration, syncPages, syncOffers, syncUpstreamErrors, syncLastSuccess, offersByGeo)
+}
+
+// RefreshOfferMetrics пересчитывает число активных офферов по GEO. GEO, из которых офферы пропали, из метрики убираются.
+func RefreshOfferMetrics(ctx context.Context) error {
+	var stats []struct {
+		GeoCode string
+		Count   int
+	}
+	if err := config.DB.WithContext(ctx).Raw("SELECT geo_code, COUNT(*) AS count FROM offers WHERE deactivated_at IS NULL GROUP BY geo_code").Scan(&stats).Error; err != nil {
+		return err
+	}
+
+	offersByGeo.Reset()
+	for _, stat := range stats {
+		offersByGeo.WithLabelValues(stat.GeoCode).Set(float64(stat.Count))
+	}
+	return nil
+}
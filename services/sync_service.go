@@ -4,24 +4,47 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
+	"time"
 
 	"context"
 	"geo_offers/config"
+	"geo_offers/geo"
 	"geo_offers/models"
 	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 const maxPages = 100
 
-// SyncOffers @Summary Synchronize offers from external API
-// @Description Loads offers from an external API , updates or creates offers in the database, and clears cache for updated GEO codes.
+// NewSyncRunID создаёт идентификатор прогона синхронизации, под ним изменения попадают в журнал аудита
+func NewSyncRunID() string {
+	return uuid.NewString()
+}
+
+// SyncOffers запускает синхронизацию с новым идентификатором прогона
+func SyncOffers() {
+	RunSync(NewSyncRunID())
+}
+
+// RunSync @Summary Synchronize offers from external API
+// @Description Loads offers from an external API , updates or creates offers in the database, deactivates offers missing from the API, and clears cache for updated GEO codes.
 // @Tags Sync
 // @Produce plain
 // @Success 200 {string} string "Все офферы загружены, обновлены и кеш очищен!"
-func SyncOffers() {
+func RunSync(runID string) {
+	actor := Actor{Type: ActorSync, ID: runID}
+	// run_id попадает во все записи лога этого прогона
+	ctx := config.WithLogAttrs(context.Background(), slog.String("run_id", runID))
+	db := config.DB.WithContext(ctx)
+	logger := config.Log("services")
+	logger.InfoContext(ctx, "Синхронизация офферов запущена")
+	start := time.Now()
+	result := syncSucceeded
+
 	client := resty.New()
 	client.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
 
@@ -29,6 +52,9 @@ func SyncOffers() {
 
 	updatedOffers := make(map[int]bool)
 	newOffers := make(map[int]bool)
+	// Офферы, которые есть в выдаче CityAds; остальные после полной загрузки деактивируются
+	seenOffers := make(map[int]bool)
+	complete := false
 
 	// Это нам нужен чтобы кеш удалять (удалять которые обновились)
 	geoUpdated := make(map[string]bool)
@@ -38,20 +64,32 @@ func SyncOffers() {
 		url := fmt.Sprintf("%s?page=%d", baseURL, page)
 		resp, err := client.R().Get(url)
 		if err != nil {
-			log.Println("Ошибка запроса к API:", err)
+			logger.ErrorContext(ctx, "Ошибка запроса к API", "page", page, "error", err)
+			syncUpstreamErrors.WithLabelValues("network").Inc()
+			result = syncFailed
+			break
+		}
+		if resp.IsError() {
+			logger.ErrorContext(ctx, "API вернуло ошибку", "page", page, "status", resp.StatusCode())
+			syncUpstreamErrors.WithLabelValues(strconv.Itoa(resp.StatusCode())).Inc()
+			result = syncFailed
 			break
 		}
 
 		var apiResponse APIResponse
 		if err := json.Unmarshal(resp.Body(), &apiResponse); err != nil {
-			log.Println("Ошибка парсинга JSON:", err)
+			logger.ErrorContext(ctx, "Ошибка парсинга JSON", "page", page, "error", err)
+			syncUpstreamErrors.WithLabelValues("invalid_json").Inc()
+			result = syncFailed
 			break
 		}
 
 		if len(apiResponse.Offers) == 0 {
-			fmt.Println("Достигнут конец страниц. Синхронизация завершена.")
+			logger.InfoContext(ctx, "Достигнут конец страниц. Синхронизация завершена.", "pages", page-1)
+			complete = true
 			break
 		}
+		syncPages.Inc()
 
 		for _, extOffer := range apiResponse.Offers {
 			if len(extOffer.Geo) == 0 {
@@ -60,7 +98,7 @@ func SyncOffers() {
 
 			externalID, err := strconv.Atoi(extOffer.ExternalID)
 			if err != nil {
-				log.Printf("Ошибка конвертации ExternalID: %s\n", extOffer.ExternalID)
+				logger.WarnContext(ctx, "Ошибка конвертации ExternalID", "external_id", extOffer.ExternalID)
 				continue
 			}
 
@@ -68,58 +106,179 @@ func SyncOffers() {
 			paymentTime, _ := strconv.Atoi(extOffer.PaymentTime)
 			ecpl, _ := strconv.ParseFloat(extOffer.Stat.ECPL, 64)
 
-			for _, geo := range extOffer.Geo {
-				if geo.Code == "Wrld" {
+			// Коды CityAds приводим к ISO alpha-2, "Wrld" становится WW. Повторы убираем.
+			var geoCodes []string
+			geoNames := make(map[string]string)
+			for _, extGeo := range extOffer.Geo {
+				geoCode, ok := geo.Normalize(extGeo.Code)
+				if !ok {
+					logger.WarnContext(ctx, "Неизвестный код GEO", "geo", extGeo.Code, "external_id", externalID)
 					continue
 				}
-
-				// Здесь вычисляем рейтинг
-				rating := ecpl * (10 * (1 - float64(approvalTime)/90)) * (100 * (1 - float64(paymentTime)/90))
-
-				newOffer := models.Offer{
-					ExternalID:   externalID,
-					Name:         extOffer.Name,
-					Currency:     extOffer.OfferCurrency.Name,
-					ApprovalTime: approvalTime,
-					SiteURL:      extOffer.SiteURL,
-					Logo:         extOffer.Logo,
-					GeoCode:      geo.Code,
-					GeoName:      geo.Name,
-					Rating:       rating,
+				if _, ok := geoNames[geoCode]; !ok {
+					geoCodes = append(geoCodes, geoCode)
+					geoNames[geoCode] = extGeo.Name
 				}
+			}
+			if len(geoCodes) == 0 {
+				continue
+			}
+			seenOffers[externalID] = true
 
-				// Здеьс проверяем есть ли оффер в БД
-				var existingOffer models.Offer
-				result := config.DB.Where("external_id = ?", externalID).First(&existingOffer)
-
-				if result.RowsAffected > 0 {
-					// Если оффер найден -> обновляем данные
-					config.DB.Model(&existingOffer).Updates(newOffer)
-					updatedOffers[externalID] = true
-					geoUpdated[geo.Code] = true // Ставим true чтобы обновить кеш для этого гео кода
-				} else {
-					// Если оффера нет -> создаем новый
-					config.DB.Create(&newOffer)
-					newOffers[externalID] = true
-					geoUpdated[geo.Code] = true // тоже самое тут делаем
-				}
+			// У оффера в БД одно GEO, поэтому берём первое из выдачи. Раньше оффер записывался по разу на каждое GEO
+			// и при каждой синхронизации менял GEO туда и обратно.
+			if len(geoCodes) > 1 {
+				logger.DebugContext(ctx, "У оффера несколько GEO, сохраняется первое", "external_id", externalID, "geo", geoCodes)
+			}
+
+			// Здесь вычисляем рейтинг
+			rating := ecpl * (10 * (1 - float64(approvalTime)/90)) * (100 * (1 - float64(paymentTime)/90))
+
+			newOffer := models.Offer{
+				ExternalID:   externalID,
+				Name:         extOffer.Name,
+				Currency:     extOffer.OfferCurrency.Name,
+				ApprovalTime: approvalTime,
+				SiteURL:      extOffer.SiteURL,
+				Logo:         extOffer.Logo,
+				GeoCode:      geoCodes[0],
+				GeoName:      geoNames[geoCodes[0]],
+				Rating:       rating,
+			}
+
+			action, geos, err := saveOffer(db, actor, newOffer)
+			if err != nil {
+				logger.ErrorContext(ctx, "Ошибка сохранения оффера", "external_id", externalID, "error", err)
+			}
+			switch action {
+			case AuditCreate:
+				newOffers[externalID] = true
+			case AuditUpdate:
+				updatedOffers[externalID] = true
+			}
+			// Кеш чистим и для прежнего GEO оффера, если оно поменялось
+			for _, geoCode := range geos {
+				geoUpdated[geoCode] = true
 			}
 		}
 	}
 
+	// Деактивируем только после полной загрузки: при ошибке на середине непрочитанные страницы
+	// выглядели бы как пропавшие офферы. Пустая выдача - скорее сбой CityAds, чем отсутствие офферов.
+	var deactivatedOffers []int
+	if complete && len(seenOffers) == 0 {
+		logger.WarnContext(ctx, "CityAds вернул пустую выдачу, деактивация офферов пропущена")
+	} else if complete {
+		deactivatedOffers = deactivateMissingOffers(ctx, db, actor, seenOffers, geoUpdated)
+	}
+
 	// Здесь очищаем кеш
-	for geo := range geoUpdated {
-		clearCacheByGeo(geo)
+	for geoCode := range geoUpdated {
+		ClearOfferCache(ctx, geoCode)
 	}
 
 	if len(updatedOffers) > 0 {
-		fmt.Printf("Обновлены %d офферов: %v\n", len(updatedOffers), getKeys(updatedOffers))
+		logger.InfoContext(ctx, "Офферы обновлены", "count", len(updatedOffers), "external_ids", getKeys(updatedOffers))
 	}
 	if len(newOffers) > 0 {
-		fmt.Printf("Добавлены %d новых офферов: %v\n", len(newOffers), getKeys(newOffers))
+		logger.InfoContext(ctx, "Добавлены новые офферы", "count", len(newOffers), "external_ids", getKeys(newOffers))
+	}
+	if len(deactivatedOffers) > 0 {
+		logger.InfoContext(ctx, "Деактивированы офферы, которых нет в CityAds", "count", len(deactivatedOffers), "external_ids", deactivatedOffers)
+	}
+
+	syncOffers.WithLabelValues("updated").Add(float64(len(updatedOffers)))
+	syncOffers.WithLabelValues("created").Add(float64(len(newOffers)))
+	syncOffers.WithLabelValues("deactivated").Add(float64(len(deactivatedOffers)))
+	if err := RefreshOfferMetrics(ctx); err != nil {
+		logger.ErrorContext(ctx, "Ошибка подсчёта офферов по GEO", "error", err)
+	}
+	syncDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	if result == syncSucceeded {
+		syncLastSuccess.SetToCurrentTime()
+	}
+
+	logger.InfoContext(ctx, "Все офферы загружены, обновлены и кеш очищен!", "result", result)
+}
+
+// saveOffer создаёт или обновляет оффер из выдачи CityAds и пишет в аудит одно событие, если оффер изменился.
+// Возвращает действие (AuditCreate, AuditUpdate или "", если ничего не поменялось) и GEO, чей кеш нужно очистить.
+// Действие возвращается и вместе с ошибкой записи в аудит: оффер к этому моменту уже сохранён.
+func saveOffer(db *gorm.DB, actor Actor, offer models.Offer) (string, []string, error) {
+	// Здеьс проверяем есть ли оффер в БД
+	var before models.Offer
+	lookup := db.Where("external_id = ?", offer.ExternalID).Limit(1).Find(&before)
+	if lookup.Error != nil {
+		return "", nil, lookup.Error
+	}
+
+	if lookup.RowsAffected == 0 {
+		// Если оффера нет -> создаем новый
+		if err := db.Create(&offer).Error; err != nil {
+			return "", nil, err
+		}
+		_, err := RecordAudit(db, actor, AuditCreate, offer.ExternalID, nil, offer)
+		return AuditCreate, []string{offer.GeoCode}, err
 	}
 
-	fmt.Println("Все офферы загружены, обновлены и кеш очищен!")
+	// Если оффер найден -> обновляем данные и пишем в аудит то, что реально поменялось
+	existing := before
+	if err := db.Model(&existing).Updates(offer).Error; err != nil {
+		return "", nil, err
+	}
+	if before.DeactivatedAt != nil {
+		// Оффер вернулся в выдачу CityAds
+		if err := db.Model(&existing).Update("deactivated_at", nil).Error; err != nil {
+			return "", nil, err
+		}
+	}
+
+	var after models.Offer
+	if err := db.Where("external_id = ?", offer.ExternalID).First(&after).Error; err != nil {
+		return "", nil, err
+	}
+	changed, err := RecordAudit(db, actor, AuditUpdate, offer.ExternalID, before, after)
+	if !changed {
+		return "", nil, err
+	}
+	if before.GeoCode != after.GeoCode {
+		return AuditUpdate, []string{before.GeoCode, after.GeoCode}, err
+	}
+	return AuditUpdate, []string{after.GeoCode}, err
+}
+
+// deactivateMissingOffers деактивирует активные офферы, которых нет в seen, пишет это в журнал аудита
+// и отмечает их GEO для очистки кеша. Возвращает ExternalID деактивированных офферов.
+func deactivateMissingOffers(ctx context.Context, db *gorm.DB, actor Actor, seen map[int]bool, geoUpdated map[string]bool) []int {
+	logger := config.Log("services")
+
+	var active []models.Offer
+	if err := db.Where("deactivated_at IS NULL").Find(&active).Error; err != nil {
+		logger.ErrorContext(ctx, "Ошибка выборки активных офферов", "error", err)
+		return nil
+	}
+
+	now := time.Now()
+	var deactivated []int
+	for _, offer := range active {
+		if seen[offer.ExternalID] {
+			continue
+		}
+
+		before := offer
+		if err := db.Model(&offer).Update("deactivated_at", now).Error; err != nil {
+			logger.ErrorContext(ctx, "Ошибка деактивации оффера", "external_id", offer.ExternalID, "error", err)
+			continue
+		}
+		offer.DeactivatedAt = &now
+		if _, err := RecordAudit(db, actor, AuditUpdate, offer.ExternalID, before, offer); err != nil {
+			logger.ErrorContext(ctx, "Ошибка записи в журнал аудита", "external_id", offer.ExternalID, "error", err)
+		}
+
+		deactivated = append(deactivated, offer.ExternalID)
+		geoUpdated[offer.GeoCode] = true
+	}
+	return deactivated
 }
 
 func getKeys(m map[int]bool) []int {
@@ -130,9 +289,25 @@ func getKeys(m map[int]bool) []int {
 	return keys
 }
 
-// Вспомогательная функция для того чтобы очистить кеш
-func clearCacheByGeo(geo string) {
-	cacheKeyPattern := fmt.Sprintf("offers:%s:*", geo)
-	config.RedisClient.Del(context.Background(), cacheKeyPattern)
-	fmt.Println("Кеш очищен для GEO:", geo)
+// ClearOfferCache очищает кеш выдачи по GEO (на всех языках), по регионам с этой страной
+// и общий отсортированный список. Офферы WW есть в любой выдаче, поэтому для них чистится весь кеш.
+func ClearOfferCache(ctx context.Context, geoCode string) {
+	if geoCode == geo.Worldwide {
+		clearCacheByPattern(ctx, "offers:*")
+	} else {
+		clearCacheByPattern(ctx, fmt.Sprintf("offers:%s:*", geoCode))
+		for _, region := range geo.RegionsOf(geoCode) {
+			clearCacheByPattern(ctx, fmt.Sprintf("offers:%s:*", region))
+		}
+	}
+	clearCacheByPattern(ctx, "offers_sorted:*")
+	config.Log("services").InfoContext(ctx, "Кеш очищен", "geo", geoCode)
+}
+
+// clearCacheByPattern удаляет ключи по маске. DEL маски не понимает, поэтому ключи ищем через SCAN.
+func clearCacheByPattern(ctx context.Context, pattern string) {
+	iter := config.RedisClient.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		config.RedisClient.Del(ctx, iter.Val())
+	}
 }